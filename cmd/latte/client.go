@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/raphaelreyna/latte/internal/job"
+	"github.com/raphaelreyna/latte/internal/server"
+)
+
+// client talks to a remote LaTTe HTTP service.
+type client struct {
+	url    string
+	apiKey string
+	token  string
+	http   *http.Client
+}
+
+// clientFlags adds the flags for running a command against a remote LaTTe server to fs.
+// The returned function gives the configured client once fs has been parsed, or nil if no server was given.
+func clientFlags(fs *flag.FlagSet) func() *client {
+	url := fs.String("server", os.Getenv("LATTE_SERVER"), "`URL` of a LaTTe server to send the work to instead of doing it locally")
+	apiKey := fs.String("api-key", os.Getenv("LATTE_API_KEY"), "API `key` to authenticate with the server")
+	token := fs.String("token", os.Getenv("LATTE_TOKEN"), "JWT to authenticate with the server as a bearer `token`")
+	timeout := fs.Duration("timeout", 2*time.Minute, "how long to wait for the server to respond")
+	return func() *client {
+		if *url == "" {
+			return nil
+		}
+		return &client{
+			url:    strings.TrimSuffix(*url, "/"),
+			apiKey: *apiKey,
+			token:  *token,
+			http:   &http.Client{Timeout: *timeout},
+		}
+	}
+}
+
+// remoteError is an error response from the server.
+type remoteError struct {
+	Status    int
+	Message   string
+	RequestID string
+}
+
+func (e *remoteError) Error() string {
+	msg := fmt.Sprintf("server responded with %d %s: %s", e.Status, http.StatusText(e.Status), e.Message)
+	if e.RequestID != "" {
+		msg += fmt.Sprintf(" (request ID %s)", e.RequestID)
+	}
+	return msg
+}
+
+// post sends payload as JSON to the server at path, returning the response if its status is one of ok.
+// Any other response is returned as an error, a *remoteError if the server explained itself.
+func (c *client) post(path string, payload interface{}, ok ...int) (*http.Response, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.url+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set(server.APIKeyHeader, c.apiKey)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error while contacting server: %v", err)
+	}
+	for _, code := range ok {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+
+	re := &remoteError{Status: resp.StatusCode, RequestID: resp.Header.Get(server.RequestIDHeader)}
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	var er struct {
+		Error     string `json:"error"`
+		Data      string `json:"data"`
+		RequestID string `json:"requestID"`
+	}
+	if err := json.Unmarshal(data, &er); err != nil || er.Error == "" {
+		re.Message = strings.TrimSpace(string(data))
+		return nil, re
+	}
+	re.Message = er.Error
+	if er.RequestID != "" {
+		re.RequestID = er.RequestID
+	}
+	// The server sends TeX's output along with compilation errors
+	if er.Data != "" {
+		return nil, &compileError{err: re, output: er.Data, texErrs: job.ParseTeXErrors(er.Data)}
+	}
+	return nil, re
+}
+
+// generate sends req to the server to be compiled, returning the resulting PDF.
+func (c *client) generate(req *job.Request) ([]byte, error) {
+	resp, err := c.post("/generate", req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	pdf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading pdf from server: %v", err)
+	}
+	return pdf, nil
+}
+
+// register registers data on the server as id.
+func (c *client) register(id string, data []byte) error {
+	payload := map[string]string{"id": id, "data": base64.StdEncoding.EncodeToString(data)}
+	resp, err := c.post("/register", payload, http.StatusOK, http.StatusConflict)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusConflict {
+		return fmt.Errorf("%s is already registered", id)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raphaelreyna/latte/internal/job"
+	"github.com/raphaelreyna/latte/internal/server"
+)
+
+func TestClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(server.APIKeyHeader) != "key" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/register" {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		var req job.Request
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set(server.RequestIDHeader, "header-id")
+		switch req.Template {
+		case "ok":
+			w.Write([]byte("%PDF"))
+		case "json":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid output field found in JSON body", "requestID": "body-id"}`))
+		case "tex":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error": "exit status 1", "data": "! Undefined control sequence.\nl.3 \\bogus\n"}`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("upstream went away\n"))
+		}
+	}))
+	defer ts.Close()
+	c := &client{url: ts.URL, apiKey: "key", token: "token", http: &http.Client{Timeout: time.Minute}}
+
+	pdf, err := c.generate(&job.Request{Template: "ok"})
+	if err != nil || string(pdf) != "%PDF" {
+		t.Fatalf("expected the pdf to be returned, got %q, %v", pdf, err)
+	}
+
+	tt := []struct {
+		Name              string
+		Template          string
+		ExpectedStatus    int
+		ExpectedMessage   string
+		ExpectedRequestID string
+	}{
+		{Name: "JSON error", Template: "json", ExpectedStatus: http.StatusBadRequest, ExpectedMessage: "invalid output field found in JSON body", ExpectedRequestID: "body-id"},
+		{Name: "Plain error", Template: "plain", ExpectedStatus: http.StatusBadGateway, ExpectedMessage: "upstream went away", ExpectedRequestID: "header-id"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := c.generate(&job.Request{Template: tc.Template})
+			var re *remoteError
+			if !errors.As(err, &re) {
+				t.Fatalf("expected a remote error, got %v", err)
+			}
+			if re.Status != tc.ExpectedStatus || re.Message != tc.ExpectedMessage || re.RequestID != tc.ExpectedRequestID {
+				t.Errorf("expected %d %q (request ID %s), got %d %q (request ID %s)",
+					tc.ExpectedStatus, tc.ExpectedMessage, tc.ExpectedRequestID, re.Status, re.Message, re.RequestID)
+			}
+		})
+	}
+
+	t.Run("Compile error", func(t *testing.T) {
+		_, err := c.generate(&job.Request{Template: "tex"})
+		var ce *compileError
+		if !errors.As(err, &ce) {
+			t.Fatalf("expected a compile error, got %v", err)
+		}
+		if len(ce.texErrs) != 1 || !strings.Contains(err.Error(), "Undefined control sequence") {
+			t.Errorf("expected the TeX error to be parsed from the output, got %v", err)
+		}
+	})
+
+	t.Run("Already registered", func(t *testing.T) {
+		if err := c.register("a.tex", []byte("a")); err == nil || err.Error() != "a.tex is already registered" {
+			t.Errorf("expected a conflict to be reported, got %v", err)
+		}
+	})
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		anon := &client{url: ts.URL, http: http.DefaultClient}
+		var re *remoteError
+		if err := anon.register("a.tex", []byte("a")); !errors.As(err, &re) || re.Status != http.StatusUnauthorized {
+			t.Errorf("expected a 401 error, got %v", err)
+		}
+	})
+
+	t.Run("Unreachable", func(t *testing.T) {
+		down := &client{url: "http://127.0.0.1:1", http: http.DefaultClient}
+		if err := down.register("a.tex", []byte("a")); err == nil || !strings.Contains(err.Error(), "error while contacting server") {
+			t.Errorf("expected a connection error, got %v", err)
+		}
+	})
+}
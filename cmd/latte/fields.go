@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/raphaelreyna/latte/internal/job"
+)
+
+func fieldsCmd(args []string) error {
+	fs := newFlagSet("fields", "[ flags ] template_tex_file",
+		"List the details fields used by a template, one per line.\n\n"+
+			"Fields used while ranging over another field are listed relative to it followed by \"[]\", e.g. Items[].Price.")
+	delims := delimFlags(fs)
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	tmpl, err := parseTemplateFile(fs.Arg(0), *delims)
+	if err != nil {
+		return err
+	}
+	for _, f := range job.Fields(tmpl) {
+		fmt.Println(f)
+	}
+	return nil
+}
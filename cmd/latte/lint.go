@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/raphaelreyna/latte/internal/job"
+)
+
+func lintCmd(args []string) error {
+	fs := newFlagSet("lint", "[ flags ] template_tex_file ...",
+		`Check templates for errors, printing any that are found as file:line:column: severity: message.
+
+Besides template syntax errors and calls to unknown functions, lint warns about delimiters that collide with TeX,
+field values that are output without being passed through texEscape, and unbalanced braces or mismatched
+\begin and \end in the static parts of the template. Only errors cause lint to fail unless -strict is given.`)
+	delims := delimFlags(fs)
+	strict := fs.Bool("strict", false, "fail if any warnings are found as well as errors")
+	if err := parseFlags(fs, args, 1, -1); err != nil {
+		return err
+	}
+	if delims.Left == "" || delims.Right == "" {
+		return usageErrorf(fs, "delimiters must not be empty")
+	}
+
+	var failed int
+	for _, path := range fs.Args() {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var fails bool
+		for _, issue := range job.Lint(path, string(data), *delims) {
+			fmt.Printf("%s:%s\n", path, issue)
+			if issue.Severity == job.SeverityError || *strict {
+				fails = true
+			}
+		}
+		if fails {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d templates have problems", failed, fs.NArg())
+	}
+	return nil
+}
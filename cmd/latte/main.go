@@ -1,86 +1,209 @@
 package main
 
 import (
-	"log"
-	"net/http"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
-	"os/exec"
-	"strconv"
+	"runtime"
+	"runtime/debug"
+	"strings"
 
-	"github.com/gorilla/handlers"
+	"github.com/raphaelreyna/latte/internal/config"
+	"github.com/raphaelreyna/latte/internal/job"
 	"github.com/raphaelreyna/latte/internal/server"
 )
 
-const (
-	// If cache sizes is not provided by environment, default to 15 for both
-	defaultTCS = 15
-	defaultRCS = 15
-)
+// version is set at build time with -ldflags "-X main.version=..."
+var version string
+
+// newDB connects to the database LaTTe was compiled with support for, if any.
+var newDB func(config.Database) (server.DB, error)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{name: "serve", summary: "Run LaTTe as an HTTP service", run: serveCmd},
+		{name: "render", summary: "Fill in a template with details and compile it into a PDF", run: renderCmd},
+		{name: "register", summary: "Register templates, details and resources for use by the HTTP service", run: registerCmd},
+		{name: "fields", summary: "List the details fields used by a template", run: fieldsCmd},
+		{name: "lint", summary: "Check templates for errors", run: lintCmd},
+		{name: "config", summary: "Print the configuration the HTTP service would run with", run: configCmd},
+		{name: "version", summary: "Print the version of LaTTe", run: versionCmd},
+	}
+}
 
-var db server.DB
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: latte <command> [ flags ] [ args ]\n\nDescription: Generate PDFs using TeX / LaTeX templates and JSON.\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s%s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'latte <command> -h' for more information on a command.\nRunning latte without a command is the same as running 'latte serve'.\n"+
+		"Running latte with flags but no command, as older versions were, is the same as running 'latte render'.\n")
+}
 
 func main() {
-	var err error
-	errLog := log.New(os.Stderr, "ERROR: ", log.Lshortfile|log.LstdFlags)
-	infoLog := log.New(os.Stdout, "INFO: ", log.Lshortfile|log.LstdFlags)
-
-	// Check for pdfLaTeX (pdfTex will do in a pinch)
-	cmd := "pdflatex"
-	if _, err := exec.LookPath(cmd); err != nil {
-		errLog.Printf("error while searching checking pdflatex binary: %v\n\tchecking for pdftex binary", err)
-		if _, err := exec.LookPath("pdftex"); err != nil {
-			errLog.Fatal("neither pdflatex nor pdftex binary found in your $PATH")
+	os.Exit(run(os.Args[1:]))
+}
+
+// run runs the command named by args and returns the status LaTTe should exit with.
+func run(args []string) int {
+	if len(args) > 0 {
+		if name := args[0]; name == "help" || name == "-h" || name == "-help" || name == "--help" {
+			usage()
+			return 0
+		}
+	}
+
+	cmd, args, err := dispatch(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "latte: %v\n\n", err)
+		usage()
+		return 2
+	}
+
+	err = cmd.run(args)
+	var ue usageError
+	switch {
+	case err == nil:
+	case err == flag.ErrHelp:
+	case errors.As(err, &ue):
+		return 2
+	default:
+		fmt.Fprintf(os.Stderr, "latte %s: %v\n", cmd.name, err)
+		return 1
+	}
+	return 0
+}
+
+// dispatch finds the command args ask for, returning it along with the args meant for it.
+func dispatch(args []string) (*command, []string, error) {
+	name := "serve"
+	switch {
+	case len(args) == 0:
+	case strings.HasPrefix(args[0], "-"):
+		// Kept so that scripts running 'latte -t template.tex -d details.json' from before there were commands
+		// continue to work
+		fmt.Fprintf(os.Stderr, "latte: running latte with flags but no command is deprecated; run 'latte render %s' instead\n", strings.Join(args, " "))
+		name = "render"
+	default:
+		name, args = args[0], args[1:]
+	}
+	// Kept so that existing deployments running 'latte server' continue to work
+	if name == "server" {
+		name = "serve"
+	}
+
+	for _, c := range commands {
+		if c.name == name {
+			return c, args, nil
 		}
-		infoLog.Printf("found pdftex binary; falling back to using pdftex instead of pdflatex")
-		cmd = "pdftex"
 	}
+	return nil, nil, fmt.Errorf("unknown command %q", name)
+}
+
+// usageError is returned by commands that were given bad flags or arguments, after their usage has been printed.
+type usageError struct {
+	error
+}
 
-	// If user provides a directory path or a tex file, then run as cli tool and not as http server
-	if len(os.Args) > 1 {
-		if os.Args[1] != "server" {
-			cli(errLog, infoLog)
-			os.Exit(0)
+// newFlagSet creates the flag set for a command whose usage is printed as "latte name synopsis" followed by
+// desc and its flags.
+func newFlagSet(name, synopsis, desc string) *flag.FlagSet {
+	fs := flag.NewFlagSet("latte "+name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: latte %s %s\n\nDescription: %s\n", name, synopsis, desc)
+		var hasFlags bool
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintf(fs.Output(), "\nFlags:\n")
+			fs.PrintDefaults()
 		}
 	}
-	root := os.Getenv("LATTE_ROOT")
-	if root == "" {
-		root, err = os.UserCacheDir()
-		if err != nil {
-			errLog.Fatalf("error creating root cache directory: %v", err)
+	return fs
+}
+
+// parseFlags parses args with fs, requiring between min and max positional arguments; max < 0 means no limit.
+func parseFlags(fs *flag.FlagSet, args []string, min, max int) error {
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return err
+	} else if err != nil {
+		return usageError{err}
+	}
+	if n := fs.NArg(); n < min || (max >= 0 && n > max) {
+		return usageErrorf(fs, "wrong number of arguments")
+	}
+	return nil
+}
+
+// usageErrorf reports a mistake in how a command was called, followed by its usage.
+func usageErrorf(fs *flag.FlagSet, format string, a ...interface{}) error {
+	err := fmt.Errorf(format, a...)
+	fmt.Fprintf(fs.Output(), "%v\n", err)
+	fs.Usage()
+	return usageError{err}
+}
+
+// delimFlags adds the flags for setting template delimiters to fs.
+func delimFlags(fs *flag.FlagSet) *job.Delimiters {
+	d := job.DefaultDelimiters
+	fs.StringVar(&d.Left, "left-delim", d.Left, "left template `delimiter`")
+	fs.StringVar(&d.Right, "right-delim", d.Right, "right template `delimiter`")
+	return &d
+}
+
+func versionCmd(args []string) error {
+	fs := newFlagSet("version", "", "Print the version of LaTTe.")
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	v := version
+	if v == "" {
+		v = "(devel)"
+		if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+			v = info.Main.Version
 		}
 	}
-	infoLog.Printf("root cache directory: %s", root)
+	fmt.Printf("latte %s %s %s/%s\n", v, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return nil
+}
 
-	tCacheSize := os.Getenv("LATTE_TMPL_CACHE_SIZE")
-	tcs, err := strconv.Atoi(tCacheSize)
-	if err != nil {
-		infoLog.Printf("couldn't pull templates cache size from environment: defaulting to %d", defaultTCS)
-		tcs = defaultTCS
+func configCmd(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		fs := newFlagSet("config", "print [ -format yaml|toml ] [ serve flags ]",
+			"Print the configuration 'latte serve' would run with given the same config file, environment and flags.")
+		return usageErrorf(fs, "expected 'print'")
 	}
-	s, err := server.NewServer(root, cmd, db, errLog, infoLog, tcs)
+	args = args[1:]
+
+	// Pull out -format so the rest of the args may be parsed as server flags
+	format := "yaml"
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		switch a := args[i]; {
+		case a == "-format" || a == "--format":
+			if i+1 < len(args) {
+				i++
+				format = args[i]
+			}
+		case strings.HasPrefix(a, "-format=") || strings.HasPrefix(a, "--format="):
+			format = a[strings.Index(a, "=")+1:]
+		default:
+			rest = append(rest, a)
+		}
+	}
+
+	cfg, err := config.Load("latte config print", rest)
 	if err != nil {
-		errLog.Fatal(err)
-	}
-
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "27182"
-	}
-	infoLog.Printf("listening for HTTP traffic on port: %s ...", port)
-	errLog.Fatal(http.ListenAndServe(":"+port, handlers.CORS(
-		handlers.AllowedHeaders([]string{
-			"Origin",
-			"X-Requested-With",
-			"Content-Type",
-			"Authorization",
-			"Access-Control-Allow-Origin",
-			"Access-Control-Request-Headers",
-			"Access-Control-Request-Method",
-		}),
-		handlers.AllowedMethods([]string{
-			"GET", "POST", "PUT",
-			"HEAD", "OPTIONS",
-		}),
-		handlers.AllowedOrigins([]string{"*"}))(s)),
-	)
+		return err
+	}
+	return cfg.Print(os.Stdout, format)
 }
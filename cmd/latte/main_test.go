@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDispatch(t *testing.T) {
+	tt := []struct {
+		Name         string
+		Args         []string
+		ExpectedCmd  string
+		ExpectedArgs []string
+		ShouldFail   bool
+	}{
+		{Name: "No command", ExpectedCmd: "serve"},
+		{Name: "Command", Args: []string{"render", "-t", "a.tex"}, ExpectedCmd: "render", ExpectedArgs: []string{"-t", "a.tex"}},
+		{Name: "Server alias", Args: []string{"server", "-port", "9000"}, ExpectedCmd: "serve", ExpectedArgs: []string{"-port", "9000"}},
+		{Name: "Flags without a command", Args: []string{"-t", "a.tex", "-d", "a.json"}, ExpectedCmd: "render", ExpectedArgs: []string{"-t", "a.tex", "-d", "a.json"}},
+		{Name: "Unknown command", Args: []string{"frob"}, ShouldFail: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			cmd, args, err := dispatch(tc.Args)
+			if tc.ShouldFail {
+				if err == nil {
+					t.Fatalf("expected an error, got command %s", cmd.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cmd.name != tc.ExpectedCmd {
+				t.Errorf("expected command %s, got %s", tc.ExpectedCmd, cmd.name)
+			}
+			if !reflect.DeepEqual(args, tc.ExpectedArgs) {
+				t.Errorf("expected args %q, got %q", tc.ExpectedArgs, args)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	tt := []struct {
+		Name     string
+		Args     []string
+		Expected int
+	}{
+		{Name: "Help", Args: []string{"-h"}, Expected: 0},
+		{Name: "Unknown command", Args: []string{"frob"}, Expected: 2},
+		{Name: "Command help", Args: []string{"render", "-h"}, Expected: 0},
+		{Name: "Usage error", Args: []string{"render"}, Expected: 2},
+		{Name: "Legacy usage error", Args: []string{"-t", "a.tex"}, Expected: 2},
+		{Name: "Command error", Args: []string{"lint", "does-not-exist.tex"}, Expected: 1},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			if code := run(tc.Args); code != tc.Expected {
+				t.Errorf("expected exit status %d, got %d", tc.Expected, code)
+			}
+		})
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	tt := []struct {
+		Name     string
+		Cmd      func([]string) error
+		Args     []string
+		Expected string
+	}{
+		{Name: "Unknown flag", Cmd: renderCmd, Args: []string{"-frob"}, Expected: "flag provided but not defined"},
+		{Name: "No template", Cmd: renderCmd, Expected: "no template/tex file provided"},
+		{Name: "No details", Cmd: renderCmd, Args: []string{"-t", "a.tex"}, Expected: "no details json file provided"},
+		{Name: "Too many arguments", Cmd: renderCmd, Args: []string{"-t", "a.tex", "-d", "a.json", "rsc", "extra"}, Expected: "wrong number of arguments"},
+		{Name: "Watching stdin", Cmd: renderCmd, Args: []string{"-t", "a.tex", "-d", "-", "-watch"}, Expected: "stdin and stdout can't be used while watching"},
+		{Name: "Preview without watch", Cmd: renderCmd, Args: []string{"-t", "a.tex", "-d", "a.json", "-preview", "localhost:0"}, Expected: "-preview requires -watch"},
+		{Name: "Invalid compiler", Cmd: renderCmd, Args: []string{"-t", "a.tex", "-d", "a.json", "-compiler", "word"}, Expected: "invalid compiler: word"},
+		{Name: "No passes", Cmd: renderCmd, Args: []string{"-t", "a.tex", "-d", "a.json", "-passes", "0"}, Expected: "passes must be at least 1"},
+		{Name: "Invalid output", Cmd: renderCmd, Args: []string{"-t", "a.tex", "-d", "a.json", "-output", "docx"}, Expected: "invalid output format"},
+		{Name: "Bad signature rect", Cmd: renderCmd, Args: []string{"-t", "a.tex", "-d", "a.json", "-sign", "visible", "-sign-rect", "1,2"}, Expected: "-sign-rect must be four comma separated numbers"},
+		{Name: "Signing key without certificate", Cmd: renderCmd, Args: []string{"-t", "a.tex", "-d", "a.json", "-sign", "invisible", "-signing-key", "key.pem"}, Expected: "-signing-key requires -signing-cert"},
+		{Name: "Keep tex with server", Cmd: renderCmd, Args: []string{"-t", "a.tex", "-d", "a.json", "-keep-tex", "-server", "http://localhost:0"}, Expected: "-keep-tex can't be used with -server"},
+		{Name: "Register nothing", Cmd: registerCmd, Expected: "wrong number of arguments"},
+		{Name: "Register several files as one ID", Cmd: registerCmd, Args: []string{"-id", "x", "a.tex", "b.tex"}, Expected: "-id can only be used when registering a single file"},
+		{Name: "Lint with empty delimiters", Cmd: lintCmd, Args: []string{"-left-delim", "", "a.tex"}, Expected: "delimiters must not be empty"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := tc.Cmd(tc.Args)
+			var ue usageError
+			if !errors.As(err, &ue) {
+				t.Fatalf("expected a usage error, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tc.Expected) {
+				t.Errorf("expected an error containing %q, got %v", tc.Expected, err)
+			}
+		})
+	}
+}
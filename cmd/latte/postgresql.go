@@ -8,12 +8,15 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"os"
 
 	"github.com/jinzhu/gorm"
 	_ "github.com/lib/pq"
+	"github.com/raphaelreyna/latte/internal/config"
+	"github.com/raphaelreyna/latte/internal/job"
+	"github.com/raphaelreyna/latte/internal/logging"
 	"github.com/raphaelreyna/latte/internal/server"
+	"github.com/sirupsen/logrus"
 )
 
 type Database struct {
@@ -27,26 +30,15 @@ type Blob struct {
 }
 
 func init() {
-	var err error
-	db, err = newDB()
-	if err != nil {
-		log.Fatalf("fatal error occurred while creating database connection pool: %v", err)
-	}
+	newDB = newPostgresDB
 }
 
-func newDB() (server.DB, error) {
-	host := os.Getenv("LATTE_DB_HOST")
-	port := os.Getenv("LATTE_DB_PORT")
-	name := os.Getenv("LATTE_DB_NAME")
-	username := os.Getenv("LATTE_DB_USERNAME")
-	password := os.Getenv("LATTE_DB_PASSWORD")
-	ssl := os.Getenv("LATTE_DB_SSL")
-
+func newPostgresDB(c config.Database) (server.DB, error) {
 	connstr := "host=%s port=%s dbname=%s user=%s password=%s"
 	connstr = connstr + " sslmode=%s connect_timeout=10"
 	connstr = fmt.Sprintf(connstr,
-		host, port, name,
-		username, password, ssl,
+		c.Host, c.Port, c.Name,
+		c.Username, c.Password, c.SSL,
 	)
 
 	var db Database
@@ -60,6 +52,9 @@ func newDB() (server.DB, error) {
 }
 
 func (db *Database) Store(ctx context.Context, uid string, i interface{}) error {
+	if err := job.CheckName(uid); err != nil {
+		return err
+	}
 	var err error
 	blob := Blob{UID: uid}
 	switch i.(type) {
@@ -77,17 +72,24 @@ func (db *Database) Store(ctx context.Context, uid string, i interface{}) error
 	default:
 		return errors.New("can only store []byte or io.ReadCloser contents")
 	}
+	logging.FromContext(ctx).WithFields(logrus.Fields{"uid": uid, "bytes": len(blob.Bytes)}).Debug("storing blob in database")
 	return db.db.Create(&blob).Error
 }
 
 func (db *Database) Fetch(ctx context.Context, uid string) (interface{}, error) {
+	if err := job.CheckName(uid); err != nil {
+		return nil, err
+	}
 	var blob Blob
+	log := logging.FromContext(ctx).WithField("uid", uid)
 	res := db.db.First(&blob, "uid = ?", uid)
 	if err := res.Error; res.RecordNotFound() {
+		log.Debug("blob not found in database")
 		return nil, &server.NotFoundError{}
 	} else if err != nil {
 		return nil, err
 	}
+	log.Debug("fetched blob from database")
 	return blob.Bytes, nil
 }
 
@@ -95,8 +97,16 @@ func (db *Database) Ping(ctx context.Context) error {
 	return db.db.DB().PingContext(ctx)
 }
 
+// Close closes the connection pool.
+func (db *Database) Close() error {
+	return db.db.Close()
+}
+
 // AddFileAs allows *Database to satisfy the recon.Source interface (github.com/raphaelreyna/go-recon)
 func (db *Database) AddFileAs(name, destination string, perm os.FileMode) error {
+	if err := job.CheckName(name); err != nil {
+		return err
+	}
 	var (
 		blob Blob
 		res  = db.db.First(&blob, "uid = ?", name)
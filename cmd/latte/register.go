@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/raphaelreyna/latte/internal/config"
+	"github.com/raphaelreyna/latte/internal/job"
+	"github.com/raphaelreyna/latte/internal/server"
+)
+
+func registerCmd(args []string) error {
+	fs := newFlagSet("register", "[ flags ] file ...",
+		`Register templates, details and resources for use by the HTTP service.
+
+Files are copied into the root directory of the HTTP service running on this machine (and stored in its database,
+assuming LaTTe was compiled with database support) under their base name, or the name given by -id.
+The root directory and database are taken from the same config file and environment variables as 'latte serve'.
+
+With -server, files are registered with a remote LaTTe server instead.`)
+	cfgPath := fs.String("config", os.Getenv("LATTE_CONFIG"), "path to a YAML or TOML config `file`")
+	root := fs.String("root", "", "the `directory` to register files in, overriding the configured root directory")
+	id := fs.String("id", "", "the `ID` to register the file as; only valid when registering a single file")
+	remote := clientFlags(fs)
+	if err := parseFlags(fs, args, 1, -1); err != nil {
+		return err
+	}
+	if *id != "" && fs.NArg() > 1 {
+		return usageErrorf(fs, "-id can only be used when registering a single file")
+	}
+	if c := remote(); c != nil {
+		return registerRemote(c, *id, fs.Args())
+	}
+
+	cfg, err := config.FromEnv(*cfgPath)
+	if err != nil {
+		return err
+	}
+	if *root != "" {
+		cfg.Root = *root
+	}
+	if cfg.Root == "" {
+		if cfg.Root, err = os.UserCacheDir(); err != nil {
+			return fmt.Errorf("error finding root cache directory: %v", err)
+		}
+	}
+	if err = os.MkdirAll(cfg.Root, os.ModePerm); err != nil {
+		return err
+	}
+
+	var db server.DB
+	if newDB != nil {
+		if db, err = newDB(cfg.Database); err != nil {
+			return fmt.Errorf("error while creating database connection pool: %v", err)
+		}
+		if c, ok := db.(io.Closer); ok {
+			defer c.Close()
+		}
+	}
+
+	for _, path := range fs.Args() {
+		name := *id
+		if name == "" {
+			name = filepath.Base(path)
+		}
+		if err = registerFile(context.Background(), cfg.Root, db, name, path); err != nil {
+			return err
+		}
+		fmt.Println(name)
+	}
+	return nil
+}
+
+// registerRemote registers each of the files at paths with the server c under their base name, or id if it isn't empty.
+func registerRemote(c *client, id string, paths []string) error {
+	for _, path := range paths {
+		name := id
+		if name == "" {
+			name = filepath.Base(path)
+		}
+		if err := job.CheckName(name); err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err = c.register(name, data); err != nil {
+			return err
+		}
+		fmt.Println(name)
+	}
+	return nil
+}
+
+// registerFile copies the file at path into root as name, storing it in db as well if it isn't nil.
+func registerFile(ctx context.Context, root string, db server.DB, name, path string) error {
+	fpath, err := job.JoinName(root, name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(fpath); err == nil {
+		return fmt.Errorf("%s is already registered", name)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if db != nil {
+		if _, err := db.Fetch(ctx, name); err == nil {
+			return fmt.Errorf("%s is already registered", name)
+		} else if _, ok := err.(*server.NotFoundError); !ok {
+			return fmt.Errorf("error while fetching file from database: %v", err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(fpath, data, os.ModePerm); err != nil {
+		return fmt.Errorf("error while writing file to local disk: %v", err)
+	}
+	if db != nil {
+		if err = db.Store(ctx, name, data); err != nil {
+			return fmt.Errorf("error while storing file in database: %v", err)
+		}
+	}
+	return nil
+}
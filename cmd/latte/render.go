@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/raphaelreyna/latte/internal/job"
+	"github.com/raphaelreyna/latte/internal/logging"
+)
+
+func renderCmd(args []string) error {
+	fs := newFlagSet("render", "[ flags ] -t template_tex_file -d details_json_file [ path/to/resources ]",
+		`Fill in a template with details and compile it into a PDF.
+
+The final argument is optional and should be a path to resources needed for compilation, defaulting to the
+directory the template is in. Resources are any files that are referenced in the .tex file such as image files.
+Compilation happens in a temporary directory so no auxiliary files are left behind. With -server, it happens on the
+server instead and only the files at the top level of the resources directory are sent.`)
+	t := fs.String("t", "", "path to .tex `file` to be used as the template")
+	d := fs.String("d", "", "path to .json `file` to be used as the details to fill in to the template, or - to read from stdin")
+	o := fs.String("o", "", "`path` to write the PDF to, or - to write to stdout (defaults to the templates name with the outputs extension, or .zip for page images)")
+	compiler := fs.String("compiler", "", "`compiler` to use, either pdflatex or latexmk (defaults to latexmk if installed)")
+	passes := fs.Uint("passes", job.DefaultOptions.N, "number of compilation passes")
+	onMissingKey := fs.String("on-missing-key", string(job.DefaultOptions.OnMissingKey), "how to handle keys missing from the details, one of error, zero or nothing")
+	keepTex := fs.Bool("keep-tex", false, "keep the filled-in .tex file, writing it next to the PDF")
+	output := fs.String("output", "pdf", "`format` to compile into, one of pdf, png, svg, dvi or ps; templates must compile with latex for formats other than pdf, and page images are written to a zip")
+	dpi := fs.Uint("dpi", 0, "resolution to render png pages at (defaults to dvipng's default)")
+	pages := fs.String("pages", "", "`pages` to produce for png, svg or ps output, e.g. 1-3,5 (defaults to all of them)")
+	conformance := fs.String("conformance", "", "PDF `standard` to conform to using the pdfx package, one of pdfa-2b, pdfx-1a or pdfx-4")
+	title := fs.String("title", "", "`title` to set in the PDF's metadata, which may be filled in from the details")
+	author := fs.String("author", "", "`author` to set in the PDF's metadata, which may be filled in from the details")
+	subject := fs.String("subject", "", "`subject` to set in the PDF's metadata, which may be filled in from the details")
+	keywords := fs.String("keywords", "", "comma separated `keywords` to set in the PDF's metadata, which may be filled in from the details")
+	userPassword := fs.String("user-password", "", "`password` needed to open the PDF, which may be filled in from the details")
+	ownerPassword := fs.String("owner-password", "", "`password` that lifts the PDF's permissions (defaults to a random one)")
+	deny := fs.String("deny", "", "comma separated `permissions` to deny readers of the encrypted PDF: print, modify, copy, annotate, fill-forms or assemble")
+	watermark := fs.String("watermark", "", "`text` to stamp across the pages of the PDF, e.g. DRAFT, which may be filled in from the details")
+	watermarkOpacity := fs.Float64("watermark-opacity", job.DefaultWatermarkOpacity, "`opacity` of the watermark, between 0 and 1")
+	watermarkAngle := fs.Float64("watermark-angle", 0, "`degrees` to rotate the watermark counterclockwise by")
+	watermarkPages := fs.String("watermark-pages", "", "`pages` to stamp the watermark on, e.g. 1-3,5 (defaults to all of them)")
+	sign := fs.String("sign", "", "sign the PDF with either an `invisible` or a visible signature, using -signing-cert or, with -server, the server's certificate")
+	signReason := fs.String("sign-reason", "", "`reason` for signing, which may be filled in from the details")
+	signLocation := fs.String("sign-location", "", "`location` of signing, which may be filled in from the details")
+	signPage := fs.Int("sign-page", 0, "`page` to show a visible signature on (defaults to the last page)")
+	signRect := fs.String("sign-rect", "", "where to show a visible signature as `left,bottom,right,top` in points (defaults to the bottom right corner)")
+	signingCert := fs.String("signing-cert", "", "PEM encoded certificate or PKCS#12 `file` to sign the PDF with; a PKCS#12 file's password is read from $LATTE_SIGNING_PASSWORD")
+	signingKey := fs.String("signing-key", "", "PEM encoded private key `file` for the signing certificate")
+	reproducible := fs.Bool("reproducible", false, "make the same inputs always compile into byte-identical output; can't be used with watermarks, encryption or signatures")
+	sourceDate := fs.Int64("source-date", 0, "time to write into reproducible output, in `seconds` since the Unix epoch (defaults to $SOURCE_DATE_EPOCH, or the epoch itself)")
+	renderOnly := fs.String("render-only", "", "fill in the template without compiling it, writing either the filled-in .tex file (`tex`) or a zip of the work directory (zip)")
+	delims := delimFlags(fs)
+	sandbox := fs.String("sandbox", "none", "`sandbox` to run the compiler in, either none or bwrap")
+	watch := fs.Bool("watch", false, "rebuild the PDF whenever the template, details or resources change")
+	debounce := fs.Duration("debounce", 300*time.Millisecond, "how long changes must settle for before rebuilding while watching")
+	preview := fs.String("preview", "", "`address` to serve a live preview of the PDF on while watching, e.g. localhost:8080")
+	remote := clientFlags(fs)
+	if err := parseFlags(fs, args, 0, 1); err != nil {
+		return err
+	}
+	if *t == "" {
+		return usageErrorf(fs, "no template/tex file provided")
+	}
+	if *d == "" {
+		return usageErrorf(fs, "no details json file provided")
+	}
+	if *watch && (*d == "-" || *o == "-") {
+		return usageErrorf(fs, "stdin and stdout can't be used while watching")
+	}
+	if *preview != "" && !*watch {
+		return usageErrorf(fs, "-preview requires -watch")
+	}
+
+	rr := &renderer{tmplPath: *t, dtlsPath: *d, out: *o, keepTex: *keepTex, opts: job.DefaultOptions, remote: remote()}
+	if rr.remote != nil && rr.keepTex {
+		return usageErrorf(fs, "-keep-tex can't be used with -server")
+	}
+	if *compiler != "" {
+		if rr.opts.CC = job.Compiler(*compiler); !rr.opts.CC.IsValid() {
+			return usageErrorf(fs, "invalid compiler: %s", *compiler)
+		}
+	} else if rr.remote != nil {
+		// Let the server pick whichever compiler it has
+		rr.opts.CC = ""
+	}
+	if rr.opts.N = *passes; rr.opts.N < 1 {
+		return usageErrorf(fs, "passes must be at least 1")
+	}
+	if rr.opts.OnMissingKey = job.MissingKeyOpt(*onMissingKey); !rr.opts.OnMissingKey.IsValid() {
+		return usageErrorf(fs, "invalid missing key mode: %s", *onMissingKey)
+	}
+	rr.opts.Delims = *delims
+	if rr.opts.Render = job.RenderMode(*renderOnly); !rr.opts.Render.IsValid() {
+		return usageErrorf(fs, "invalid render mode: %s", *renderOnly)
+	}
+	rr.opts.Output, rr.opts.DPI, rr.opts.Pages = job.OutputFormat(*output), *dpi, *pages
+	rr.opts.Conformance = job.Conformance(*conformance)
+	rr.opts.Metadata = job.Metadata{Title: *title, Author: *author, Subject: *subject}
+	if *keywords != "" {
+		rr.opts.Metadata.Keywords = strings.Split(*keywords, ",")
+	}
+	if *watermark != "" {
+		rr.opts.Watermark = job.Watermark{Text: *watermark, Opacity: *watermarkOpacity, Angle: *watermarkAngle, Pages: *watermarkPages}
+	}
+	rr.opts.Encryption = job.Encryption{UserPassword: *userPassword, OwnerPassword: *ownerPassword}
+	if *deny != "" {
+		for _, p := range strings.Split(*deny, ",") {
+			rr.opts.Encryption.Deny = append(rr.opts.Encryption.Deny, job.Permission(strings.TrimSpace(p)))
+		}
+	}
+	rr.opts.Signature = job.Signature{Mode: job.SignatureMode(*sign), Reason: *signReason, Location: *signLocation, Page: *signPage}
+	if *signRect != "" {
+		parts := strings.Split(*signRect, ",")
+		if len(parts) != 4 {
+			return usageErrorf(fs, "-sign-rect must be four comma separated numbers")
+		}
+		for i, p := range parts {
+			var err error
+			if rr.opts.Signature.Rect[i], err = strconv.ParseFloat(strings.TrimSpace(p), 64); err != nil {
+				return usageErrorf(fs, "-sign-rect must be four comma separated numbers")
+			}
+		}
+	}
+	rr.opts.Reproducible, rr.opts.SourceDate = *reproducible, *sourceDate
+	if sde := os.Getenv("SOURCE_DATE_EPOCH"); sde != "" && rr.opts.Reproducible && rr.opts.SourceDate == 0 {
+		var err error
+		if rr.opts.SourceDate, err = strconv.ParseInt(sde, 10, 64); err != nil {
+			return fmt.Errorf("invalid $SOURCE_DATE_EPOCH: %s", sde)
+		}
+	}
+	if err := rr.opts.CheckOutput(); err != nil {
+		return usageErrorf(fs, "%v", err)
+	}
+	if *signingCert != "" || *signingKey != "" {
+		if rr.remote != nil {
+			return usageErrorf(fs, "-signing-cert and -signing-key can't be used with -server, which signs with its own certificate")
+		}
+		if rr.opts.Signature.IsZero() {
+			return usageErrorf(fs, "-signing-cert and -signing-key require -sign")
+		}
+		if *signingCert == "" {
+			return usageErrorf(fs, "-signing-key requires -signing-cert")
+		}
+		signer, err := job.LoadSigner(*signingCert, *signingKey, os.Getenv("LATTE_SIGNING_PASSWORD"))
+		if err != nil {
+			return fmt.Errorf("error while loading signing certificate: %v", err)
+		}
+		rr.opts.Signer = signer
+	} else if !rr.opts.Signature.IsZero() && rr.remote == nil {
+		return usageErrorf(fs, "-sign requires -signing-cert")
+	}
+	if *preview != "" && rr.opts.Output.Ext() != string(job.OF_PDF) {
+		return usageErrorf(fs, "-preview can only be used with pdf output")
+	}
+	if rr.opts.Render != job.RM_Compile {
+		if rr.keepTex {
+			return usageErrorf(fs, "-keep-tex can't be used with -render-only")
+		}
+		if *preview != "" {
+			return usageErrorf(fs, "-preview can't be used with -render-only")
+		}
+	}
+
+	if *sandbox != "none" {
+		if rr.opts.Sandbox = job.Sandbox(*sandbox); !rr.opts.Sandbox.IsValid() {
+			return usageErrorf(fs, "invalid sandbox: %s", *sandbox)
+		}
+	}
+	if rr.remote == nil && rr.opts.Render == job.RM_Compile {
+		if _, err := findTeX(logging.Discard()); err != nil {
+			return err
+		}
+		if err := rr.opts.Sandbox.Available(); err != nil {
+			return err
+		}
+	}
+
+	if filepath.Ext(rr.tmplPath) != ".tex" {
+		return fmt.Errorf("%s must be a valid .tex file", rr.tmplPath)
+	}
+
+	var err error
+	rr.rscDir = fs.Arg(0)
+	if rr.rscDir == "" {
+		rr.rscDir = filepath.Dir(rr.tmplPath)
+	}
+	if rr.rscDir, err = filepath.Abs(rr.rscDir); err != nil {
+		return err
+	}
+	if info, err := os.Stat(rr.rscDir); err != nil {
+		return fmt.Errorf("error while reading info for %s: %v", rr.rscDir, err)
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", rr.rscDir)
+	}
+
+	if rr.out == "" {
+		rr.out = strings.TrimSuffix(filepath.Base(rr.tmplPath), ".tex")
+		switch rr.opts.Render {
+		case job.RM_Tex:
+			rr.out += "_filled-in.tex"
+		case job.RM_Zip:
+			rr.out += ".zip"
+		default:
+			if rr.opts.Output.Paged() {
+				rr.out += ".zip"
+			} else {
+				rr.out += "." + rr.opts.Output.Ext()
+			}
+		}
+	}
+
+	if *watch {
+		return watchAndRender(rr, *debounce, *preview)
+	}
+	if _, err = rr.render(); err != nil {
+		return err
+	}
+	if rr.out != "-" {
+		what := strings.ToUpper(rr.opts.Output.Ext())
+		if rr.opts.Output.Paged() {
+			what += " pages"
+		}
+		if rr.opts.Render != job.RM_Compile {
+			what = "filled-in template"
+		}
+		fmt.Fprintf(os.Stderr, "Successfully created %s at location: %s\n", what, rr.out)
+	}
+	return nil
+}
+
+// renderer fills in a template file with a details file and compiles the results.
+type renderer struct {
+	tmplPath string
+	dtlsPath string
+	rscDir   string
+	// out is where the PDF, or other output, is written, "-" for stdout
+	out     string
+	keepTex bool
+	opts    job.Options
+	// remote is the server to compile on, or nil to compile locally
+	remote *client
+}
+
+// render reads the template and details, compiles them and writes the resulting PDF to rr.out, returning its contents.
+// If the options call for only rendering the template, the filled-in tex file or zip is written in place of the PDF.
+// Errors reported by TeX are returned as a compileError.
+func (rr *renderer) render() ([]byte, error) {
+	var pdf []byte
+	var err error
+	if rr.remote != nil {
+		pdf, err = rr.compileRemote()
+	} else {
+		pdf, err = rr.compileLocal()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if rr.out == "-" {
+		_, err = os.Stdout.Write(pdf)
+	} else {
+		err = ioutil.WriteFile(rr.out, pdf, 0644)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while writing pdf: %v", err)
+	}
+	return pdf, nil
+}
+
+// compileLocal compiles the template and details in a temporary directory, returning the resulting PDF or whatever
+// else the render mode calls for.
+func (rr *renderer) compileLocal() ([]byte, error) {
+	tmpl, err := parseTemplateFile(rr.tmplPath, rr.opts.Delims)
+	if err != nil {
+		return nil, err
+	}
+	dtls, err := readDetails(rr.dtlsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	workDir, err := ioutil.TempDir("", "latte-")
+	if err != nil {
+		return nil, fmt.Errorf("error while creating work directory: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+	if err = linkResources(rr.rscDir, workDir); err != nil {
+		return nil, err
+	}
+
+	j := job.NewJob(workDir, nil)
+	j.Template = tmpl
+	j.Details = dtls
+	j.Opts = rr.opts
+
+	// The job's log entries are only of interest to the HTTP service
+	ctx := logging.NewContext(context.Background(), logging.Discard())
+	switch rr.opts.Render {
+	case job.RM_Tex:
+		if err = j.Fill(ctx); err != nil {
+			return nil, fmt.Errorf("error while filling in template: %v", err)
+		}
+		return ioutil.ReadFile(j.TexFile)
+	case job.RM_Zip:
+		if err = j.Fill(ctx); err != nil {
+			return nil, fmt.Errorf("error while filling in template: %v", err)
+		}
+		var buf bytes.Buffer
+		if err = j.WriteZip(&buf); err != nil {
+			return nil, fmt.Errorf("error while zipping work directory: %v", err)
+		}
+		return buf.Bytes(), nil
+	}
+
+	pdfPath, err := j.Compile(ctx)
+	if rr.keepTex && j.TexFile != "" {
+		if err := copyFile(rr.texOut(), j.TexFile); err != nil {
+			return nil, fmt.Errorf("error while keeping filled-in tex file: %v", err)
+		}
+	}
+	if err != nil {
+		// On failure, Compile returns the compilers output in place of the PDF's location
+		if pdfPath != "" {
+			return nil, &compileError{err: err, output: pdfPath, texErrs: job.ParseTeXErrors(pdfPath)}
+		}
+		return nil, fmt.Errorf("error while compiling pdf: %v", err)
+	}
+
+	if rr.opts.Output.Paged() {
+		var buf bytes.Buffer
+		if err = j.WriteOutputsZip(&buf); err != nil {
+			return nil, fmt.Errorf("error while zipping pages: %v", err)
+		}
+		return buf.Bytes(), nil
+	}
+	return ioutil.ReadFile(filepath.Join(workDir, pdfPath))
+}
+
+// compileRemote sends the template, details and resources to rr.remote to be compiled, returning the resulting PDF or
+// whatever else the render mode calls for.
+func (rr *renderer) compileRemote() ([]byte, error) {
+	tmpl, err := ioutil.ReadFile(rr.tmplPath)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading template %s: %v", rr.tmplPath, err)
+	}
+	// Catch syntax errors before bothering the server
+	if _, err = parseTemplateFile(rr.tmplPath, rr.opts.Delims); err != nil {
+		return nil, err
+	}
+	dtls, err := readDetails(rr.dtlsPath)
+	if err != nil {
+		return nil, err
+	}
+	rscs, err := rr.readResources()
+	if err != nil {
+		return nil, err
+	}
+
+	return rr.remote.generate(&job.Request{
+		Template:     base64.StdEncoding.EncodeToString(tmpl),
+		Details:      dtls,
+		Resources:    rscs,
+		Delimiters:   rr.opts.Delims,
+		OnMissingKey: rr.opts.OnMissingKey,
+		Compiler:     rr.opts.CC,
+		Count:        rr.opts.N,
+		Render:       rr.opts.Render,
+		Output:       rr.opts.Output,
+		DPI:          rr.opts.DPI,
+		Pages:        rr.opts.Pages,
+		Conformance:  rr.opts.Conformance,
+		Metadata:     rr.opts.Metadata,
+		Encryption:   rr.opts.Encryption,
+		Watermark:    rr.opts.Watermark,
+		Signature:    rr.opts.Signature,
+		Reproducible: rr.opts.Reproducible,
+		SourceDate:   rr.opts.SourceDate,
+	})
+}
+
+// readResources base64 encodes the regular files at the top level of the resources directory.
+// Hidden files, the template, details and any previously rendered output are left out.
+func (rr *renderer) readResources() (map[string]string, error) {
+	infos, err := ioutil.ReadDir(rr.rscDir)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading resources directory %s: %v", rr.rscDir, err)
+	}
+	skip := map[string]bool{}
+	for _, path := range []string{rr.tmplPath, rr.dtlsPath, rr.out, rr.texOut()} {
+		if abs, err := filepath.Abs(path); err == nil {
+			skip[abs] = true
+		}
+	}
+
+	rscs := map[string]string{}
+	for _, info := range infos {
+		path := filepath.Join(rr.rscDir, info.Name())
+		if info.Mode()&os.ModeSymlink != 0 {
+			if info, err = os.Stat(path); err != nil {
+				return nil, fmt.Errorf("error while reading info for resource %s: %v", path, err)
+			}
+		}
+		if !info.Mode().IsRegular() || strings.HasPrefix(info.Name(), ".") || skip[path] {
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading resource %s: %v", info.Name(), err)
+		}
+		rscs[info.Name()] = base64.StdEncoding.EncodeToString(data)
+	}
+	return rscs, nil
+}
+
+// texOut returns where the filled-in tex file is kept.
+func (rr *renderer) texOut() string {
+	if rr.out == "-" {
+		return strings.TrimSuffix(filepath.Base(rr.tmplPath), ".tex") + "_filled-in.tex"
+	}
+	return strings.TrimSuffix(rr.out, filepath.Ext(rr.out)) + "_filled-in.tex"
+}
+
+// compileError is returned when TeX fails to compile the filled-in template.
+type compileError struct {
+	err     error
+	output  string
+	texErrs []job.TeXError
+}
+
+// Error lists the errors found in TeX's output, falling back to the whole output if none could be found.
+func (ce *compileError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "error while compiling pdf: %v", ce.err)
+	if len(ce.texErrs) == 0 {
+		sb.WriteString("\n" + strings.TrimSpace(ce.output))
+	}
+	for _, e := range ce.texErrs {
+		sb.WriteString("\n  " + e.Error())
+	}
+	return sb.String()
+}
+
+// parseTemplateFile parses the template in the file at path using the delimiters d.
+func parseTemplateFile(path string, d job.Delimiters) (*template.Template, error) {
+	if d.Left == "" || d.Right == "" {
+		return nil, errors.New("delimiters must not be empty")
+	}
+	tmpl, err := template.New(filepath.Base(path)).Delims(d.Left, d.Right).Funcs(job.Funcs).ParseFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("error while parsing template %s: %v", path, err)
+	}
+	return tmpl, nil
+}
+
+// readDetails decodes the details json file at path, or from stdin if path is "-".
+func readDetails(path string) (map[string]interface{}, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		if filepath.Ext(path) != ".json" {
+			return nil, fmt.Errorf("%s must be a valid .json file", path)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("error while opening details json file %s: %v", path, err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var dtls map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&dtls); err != nil {
+		return nil, fmt.Errorf("error while decoding details json from %s: %v", path, err)
+	}
+	return dtls, nil
+}
+
+// linkResources soft links everything in rscDir into workDir so that it's available during compilation.
+func linkResources(rscDir, workDir string) error {
+	infos, err := ioutil.ReadDir(rscDir)
+	if err != nil {
+		return fmt.Errorf("error while reading resources directory %s: %v", rscDir, err)
+	}
+	for _, info := range infos {
+		if err = os.Symlink(filepath.Join(rscDir, info.Name()), filepath.Join(workDir, info.Name())); err != nil {
+			return fmt.Errorf("error while linking resource %s: %v", info.Name(), err)
+		}
+	}
+	return nil
+}
+
+// copyFile copies the file at src to dst, replacing dst if it exists.
+func copyFile(dst, src string) error {
+	sf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+	df, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(df, sf); err != nil {
+		df.Close()
+		return err
+	}
+	return df.Close()
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/handlers"
+	"github.com/raphaelreyna/latte/internal/config"
+	"github.com/raphaelreyna/latte/internal/job"
+	"github.com/raphaelreyna/latte/internal/logging"
+	"github.com/raphaelreyna/latte/internal/server"
+	"github.com/raphaelreyna/latte/internal/tracing"
+	"github.com/sirupsen/logrus"
+)
+
+func serveCmd(args []string) error {
+	cfg, err := config.Load("latte serve", args)
+	if err != nil {
+		return err
+	}
+
+	logger, err := logging.New(os.Stderr, logging.Format(cfg.Log.Format), cfg.Log.Level)
+	if err != nil {
+		return fmt.Errorf("error while configuring logger: %v", err)
+	}
+	if cfg.File != "" {
+		logger.WithField("file", cfg.File).Info("loaded config file")
+	}
+
+	cmd, err := findTeX(logger)
+	if err != nil {
+		return err
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Exporter(cfg.TraceExporter))
+	if err != nil {
+		return fmt.Errorf("error while configuring tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	if err = setJobDefaults(cfg.Job); err != nil {
+		return err
+	}
+
+	root := cfg.Root
+	if root == "" {
+		root, err = os.UserCacheDir()
+		if err != nil {
+			return fmt.Errorf("error creating root cache directory: %v", err)
+		}
+	}
+	logger.WithField("root", root).Info("using root cache directory")
+
+	var db server.DB
+	if newDB != nil {
+		if db, err = newDB(cfg.Database); err != nil {
+			return fmt.Errorf("error while creating database connection pool: %v", err)
+		}
+	}
+
+	auth, err := server.NewAuthenticatorFromEnv()
+	if err != nil {
+		return fmt.Errorf("error while configuring authentication: %v", err)
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.TLS.CertFile != "" || cfg.TLS.KeyFile != "" {
+		tf := &server.TLSFiles{
+			CertFile:     cfg.TLS.CertFile,
+			KeyFile:      cfg.TLS.KeyFile,
+			ClientCAFile: cfg.TLS.ClientCAFile,
+			ClientAuth:   server.ClientAuth(cfg.TLS.ClientAuth),
+		}
+		if err = tf.Check(); err != nil {
+			return err
+		}
+		if _, err = tf.Load(); err != nil {
+			return fmt.Errorf("error while loading TLS files: %v", err)
+		}
+		if interval := cfg.TLS.ReloadInterval.Duration; interval > 0 {
+			ctx, stopWatching := context.WithCancel(context.Background())
+			defer stopWatching()
+			go tf.Watch(ctx, interval, logger)
+		} else {
+			logger.Info("TLS file reloading is disabled")
+		}
+		tlsConfig = tf.Config()
+		logger.Info("TLS is enabled")
+
+		if cfg.TLS.ClientIdentitiesFile != "" {
+			if cfg.TLS.ClientCAFile == "" {
+				return errors.New("client certificate identities require a client CA file")
+			}
+			certAuth, err := loadClientCerts(cfg.TLS.ClientIdentitiesFile)
+			if err != nil {
+				return err
+			}
+			// Try client certificates first since they're checked on every connection anyway
+			chain := server.AuthChain{certAuth}
+			if auth != nil {
+				chain = append(chain, auth)
+			}
+			auth = chain
+		}
+	} else if cfg.TLS.ClientCAFile != "" || cfg.TLS.ClientIdentitiesFile != "" || cfg.TLS.ClientAuth != "" {
+		return errors.New("client certificates require a TLS certificate and key")
+	}
+
+	var opts []server.Option
+	if auth != nil {
+		logger.Info("authentication is enabled")
+		opts = append(opts, server.WithAuthenticator(auth))
+	}
+
+	opts = append(opts, server.WithLimits(server.Limits{
+		Rate:          cfg.Limits.Rate,
+		Burst:         cfg.Limits.Burst,
+		DailyCompiles: cfg.Limits.DailyCompiles,
+		DailyStorage:  cfg.Limits.DailyStorage,
+	}))
+	if cfg.Limits.MaxActiveJobs > 0 {
+		opts = append(opts, server.WithJobQueue(cfg.Limits.MaxActiveJobs, cfg.Limits.MaxQueuedJobs))
+	}
+	opts = append(opts, server.WithMinFreeSpace(cfg.Limits.MinFreeSpace))
+	opts = append(opts, server.WithRequestLimits(job.RequestLimits{
+		MaxBodySize:     cfg.Limits.MaxBodySize,
+		MaxResources:    cfg.Limits.MaxResources,
+		MaxResourceSize: cfg.Limits.MaxResourceSize,
+		MaxDetailsDepth: cfg.Limits.MaxDetailsDepth,
+	}))
+
+	s, err := server.NewServer(root, cmd, db, logger, cfg.TemplateCacheSize, opts...)
+	if err != nil {
+		return err
+	}
+
+	handler := handlers.CORS(
+		handlers.AllowedHeaders([]string{
+			"Origin",
+			"X-Requested-With",
+			"Content-Type",
+			"Authorization",
+			server.APIKeyHeader,
+			server.RequestIDHeader,
+			"traceparent",
+			"tracestate",
+			"Access-Control-Allow-Origin",
+			"Access-Control-Request-Headers",
+			"Access-Control-Request-Method",
+		}),
+		handlers.AllowedMethods([]string{
+			"GET", "POST", "PUT",
+			"HEAD", "OPTIONS",
+		}),
+		handlers.AllowedOrigins(cfg.CORSOrigins),
+		handlers.ExposedHeaders([]string{server.RequestIDHeader}))(s)
+
+	addr := net.JoinHostPort(cfg.Address, cfg.Port)
+	logger.WithField("address", addr).Info("listening for HTTP traffic")
+	return serve(logger, s, handler, addr, tlsConfig, cfg.ShutdownGrace.Duration)
+}
+
+// findTeX returns the name of the TeX binary to use; pdfLaTeX is preferred but pdfTeX will do in a pinch.
+func findTeX(logger logrus.FieldLogger) (string, error) {
+	cmd := "pdflatex"
+	if _, err := exec.LookPath(cmd); err != nil {
+		logger.WithError(err).Warn("error while checking for pdflatex binary; checking for pdftex binary")
+		if _, err := exec.LookPath("pdftex"); err != nil {
+			return "", errors.New("neither pdflatex nor pdftex binary found in your $PATH")
+		}
+		logger.Info("found pdftex binary; falling back to using pdftex instead of pdflatex")
+		cmd = "pdftex"
+	}
+	return cmd, nil
+}
+
+// setJobDefaults sets the options used by jobs that don't set their own.
+func setJobDefaults(c config.Job) error {
+	opts := job.DefaultOptions
+	if c.Compiler != "" {
+		if opts.CC = job.Compiler(c.Compiler); !opts.CC.IsValid() {
+			return fmt.Errorf("invalid default compiler: %s", c.Compiler)
+		}
+	}
+	if c.Passes > 0 {
+		opts.N = c.Passes
+	}
+	if c.OnMissingKey != "" {
+		if opts.OnMissingKey = job.MissingKeyOpt(c.OnMissingKey); !opts.OnMissingKey.IsValid() {
+			return fmt.Errorf("invalid default missing key mode: %s", c.OnMissingKey)
+		}
+	}
+	if c.LeftDelim != "" || c.RightDelim != "" {
+		if c.LeftDelim == "" || c.RightDelim == "" {
+			return errors.New("both default delimiters must be set")
+		}
+		opts.Delims = job.Delimiters{Left: c.LeftDelim, Right: c.RightDelim}
+	}
+	if c.Sandbox != "none" {
+		if opts.Sandbox = job.Sandbox(c.Sandbox); !opts.Sandbox.IsValid() {
+			return fmt.Errorf("invalid sandbox: %s", c.Sandbox)
+		}
+	}
+	if err := opts.Sandbox.Available(); err != nil {
+		return err
+	}
+	if c.SigningCert != "" {
+		signer, err := job.LoadSigner(c.SigningCert, c.SigningKey, c.SigningPassword)
+		if err != nil {
+			return fmt.Errorf("error while loading signing certificate: %v", err)
+		}
+		opts.Signer = signer
+	} else if c.SigningKey != "" {
+		return errors.New("a signing key requires a signing certificate")
+	}
+	job.DefaultOptions = opts
+	job.DefaultDelimiters = opts.Delims
+	return nil
+}
+
+// loadClientCerts reads the client certificate identities file at path.
+func loadClientCerts(path string) (server.ClientCerts, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cc, err := server.ParseClientCerts(f)
+	if err != nil {
+		return nil, fmt.Errorf("error while parsing %s: %v", path, err)
+	}
+	return cc, nil
+}
+
+// serve has h listen for HTTP traffic on addr until the process is interrupted or terminated; HTTPS is served if
+// tlsConfig isn't nil.
+// Once signaled, no new requests are accepted and running jobs are given the grace period to finish before being
+// canceled. Shutdown is complete once all work directories have been cleaned up and the database is closed.
+func serve(logger logrus.FieldLogger, s *server.Server, h http.Handler, addr string, tlsConfig *tls.Config, grace time.Duration) error {
+	// Every request context descends from jobsCtx, canceling it cancels every running job.
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+
+	srv := &http.Server{
+		Addr:        addr,
+		Handler:     h,
+		TLSConfig:   tlsConfig,
+		BaseContext: func(net.Listener) context.Context { return jobsCtx },
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		if tlsConfig != nil {
+			// The certificate is provided by tlsConfig
+			errs <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		errs <- srv.ListenAndServe()
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-sigs:
+		logger.WithFields(logrus.Fields{"signal": sig, "grace": grace}).Info("shutting down; waiting for running jobs to finish")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.WithError(err).Warn("grace period expired; canceling running jobs")
+		cancelJobs()
+	}
+
+	// Give canceled jobs a moment to clean up after themselves
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.Close(ctx); err != nil {
+		return err
+	}
+	logger.Info("shutdown complete")
+	return nil
+}
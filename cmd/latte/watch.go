@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// watchPollInterval is how often watched files are checked for changes.
+const watchPollInterval = 250 * time.Millisecond
+
+// watchAndRender renders once and then again each time the watched files change, until interrupted.
+// Changes must settle for the debounce period before a rebuild starts so that a burst of saves causes a single rebuild.
+// If previewAddr isn't empty, the latest PDF is served there for viewing in a browser.
+func watchAndRender(rr *renderer, debounce time.Duration, previewAddr string) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	p := &preview{}
+	if previewAddr != "" {
+		l, err := net.Listen("tcp", previewAddr)
+		if err != nil {
+			return fmt.Errorf("error while starting preview server: %v", err)
+		}
+		srv := &http.Server{Handler: p}
+		go srv.Serve(l)
+		defer srv.Close()
+		fmt.Fprintf(os.Stderr, "Serving preview at http://%s\n", l.Addr())
+	}
+
+	rebuild := func() {
+		start := time.Now()
+		pdf, err := rr.render()
+		p.update(pdf, err)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[%s] %v\n", start.Format("15:04:05"), err)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "[%s] wrote %s in %s\n", start.Format("15:04:05"), rr.out, time.Since(start).Round(time.Millisecond))
+	}
+
+	fmt.Fprintf(os.Stderr, "Watching %s, %s and %s for changes; press Ctrl+C to stop\n", rr.tmplPath, rr.dtlsPath, rr.rscDir)
+	rebuild()
+
+	last := rr.stamp()
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	var changedAt time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if s := rr.stamp(); s != last {
+			last = s
+			changedAt = time.Now()
+			continue
+		}
+		if !changedAt.IsZero() && time.Since(changedAt) >= debounce {
+			changedAt = time.Time{}
+			rebuild()
+		}
+	}
+}
+
+// stamp summarizes the modification times and sizes of the files that go into rendering.
+// Hidden files and directories in the resources directory are skipped, as are the files being written.
+func (rr *renderer) stamp() string {
+	var sb strings.Builder
+	add := func(path string, info os.FileInfo) {
+		fmt.Fprintf(&sb, "%s:%d:%d;", path, info.ModTime().UnixNano(), info.Size())
+	}
+	for _, path := range []string{rr.tmplPath, rr.dtlsPath} {
+		if info, err := os.Stat(path); err == nil {
+			add(path, info)
+		}
+	}
+
+	out, _ := filepath.Abs(rr.out)
+	texOut, _ := filepath.Abs(rr.texOut())
+	filepath.Walk(rr.rscDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path != rr.rscDir && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() && path != out && path != texOut {
+			add(path, info)
+		}
+		return nil
+	})
+	return sb.String()
+}
+
+// preview serves the most recently rendered PDF along with a page that reloads it whenever it changes.
+type preview struct {
+	mu      sync.RWMutex
+	pdf     []byte
+	err     string
+	version int
+}
+
+func (p *preview) update(pdf []byte, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.version++
+	p.err = ""
+	if err != nil {
+		// Keep showing the last good PDF along with the error
+		p.err = err.Error()
+		return
+	}
+	p.pdf = pdf
+}
+
+func (p *preview) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch r.URL.Path {
+	case "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(previewPage))
+	case "/status":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"version": p.version, "error": p.err})
+	case "/latest.pdf":
+		if p.pdf == nil {
+			http.Error(w, "no PDF has been rendered yet", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write(p.pdf)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+const previewPage = `<!DOCTYPE html>
+<html>
+<head>
+<title>LaTTe preview</title>
+<style>
+html, body { margin: 0; height: 100%; font-family: sans-serif; }
+#error { display: none; margin: 0; padding: 1em; background: #fdd; white-space: pre-wrap; }
+#pdf { border: 0; width: 100%; height: 100%; }
+</style>
+</head>
+<body>
+<pre id="error"></pre>
+<iframe id="pdf"></iframe>
+<script>
+var version = -1;
+function poll() {
+	fetch('/status').then(function(r) { return r.json(); }).then(function(s) {
+		var e = document.getElementById('error');
+		e.textContent = s.error;
+		e.style.display = s.error ? 'block' : 'none';
+		if (s.version !== version && !s.error) {
+			document.getElementById('pdf').src = '/latest.pdf?v=' + s.version;
+		}
+		version = s.version;
+	}).catch(function() {}).then(function() { setTimeout(poll, 1000); });
+}
+poll();
+</script>
+</body>
+</html>
+`
@@ -3,16 +3,29 @@ module github.com/raphaelreyna/latte
 go 1.16
 
 require (
-	github.com/felixge/httpsnoop v1.0.2 // indirect
+	github.com/BurntSushi/toml v0.3.1
+	github.com/felixge/httpsnoop v1.0.2
+	github.com/golang-jwt/jwt/v4 v4.4.3
 	github.com/gorilla/handlers v1.5.1
 	github.com/gorilla/mux v1.8.0
 	github.com/hashicorp/golang-lru v0.5.4
 	github.com/jinzhu/gorm v1.9.16
 	github.com/lib/pq v1.10.3
 	github.com/mattn/go-sqlite3 v2.0.1+incompatible // indirect
+	github.com/pdfcpu/pdfcpu v0.3.12
+	github.com/prometheus/client_golang v1.11.1
 	github.com/raphaelreyna/go-recon v0.1.0
 	github.com/rs/cors v1.8.0
+	github.com/sirupsen/logrus v1.8.1
 	github.com/zmb3/gogetdoc v0.0.0-20190228002656-b37376c5da6a // indirect
+	go.mozilla.org/pkcs7 v0.9.0
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.1
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
 	golang.org/x/tools v0.1.5 // indirect
 	google.golang.org/appengine v1.4.0 // indirect
+	gopkg.in/yaml.v2 v2.4.0
+	software.sslmate.com/src/go-pkcs12 v0.0.0-20210415151418-c5206de65a78
 )
@@ -0,0 +1,414 @@
+// Package config gathers the LaTTe server's settings from a config file, the environment and command line flags.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Config holds every setting the LaTTe server can be started with.
+type Config struct {
+	// File is the path of the config file the settings were read from, if any
+	File string `yaml:"-" toml:"-"`
+
+	Address           string   `yaml:"address" toml:"address"`
+	Port              string   `yaml:"port" toml:"port"`
+	Root              string   `yaml:"root" toml:"root"`
+	TemplateCacheSize int      `yaml:"templateCacheSize" toml:"templateCacheSize"`
+	CORSOrigins       []string `yaml:"corsOrigins" toml:"corsOrigins"`
+	ShutdownGrace     Duration `yaml:"shutdownGrace" toml:"shutdownGrace"`
+
+	Log           Log    `yaml:"log" toml:"log"`
+	TraceExporter string `yaml:"traceExporter" toml:"traceExporter"`
+
+	TLS      TLS      `yaml:"tls" toml:"tls"`
+	Job      Job      `yaml:"job" toml:"job"`
+	Limits   Limits   `yaml:"limits" toml:"limits"`
+	Database Database `yaml:"database" toml:"database"`
+}
+
+// Log configures LaTTe's log entries.
+type Log struct {
+	Format string `yaml:"format" toml:"format"`
+	Level  string `yaml:"level" toml:"level"`
+}
+
+// TLS configures serving HTTPS and authenticating clients by their certificates.
+type TLS struct {
+	CertFile string `yaml:"certFile" toml:"certFile"`
+	KeyFile  string `yaml:"keyFile" toml:"keyFile"`
+	// ReloadInterval is how often the files are checked for changes; zero disables reloading
+	ReloadInterval Duration `yaml:"reloadInterval" toml:"reloadInterval"`
+
+	ClientCAFile string `yaml:"clientCAFile" toml:"clientCAFile"`
+	// ClientAuth is either "request" or "require"
+	ClientAuth string `yaml:"clientAuth" toml:"clientAuth"`
+	// ClientIdentitiesFile maps the names found in client certificates to scopes
+	ClientIdentitiesFile string `yaml:"clientIdentitiesFile" toml:"clientIdentitiesFile"`
+}
+
+// Job holds the options used by jobs that don't set their own, along with how every job's compiler is confined.
+type Job struct {
+	Compiler     string `yaml:"compiler" toml:"compiler"`
+	Passes       uint   `yaml:"passes" toml:"passes"`
+	OnMissingKey string `yaml:"onMissingKey" toml:"onMissingKey"`
+	LeftDelim    string `yaml:"leftDelim" toml:"leftDelim"`
+	RightDelim   string `yaml:"rightDelim" toml:"rightDelim"`
+	Sandbox      string `yaml:"sandbox" toml:"sandbox"`
+	// SigningCert is either a PEM encoded certificate or a PKCS#12 (.p12 or .pfx) file holding the key as well
+	SigningCert     string `yaml:"signingCert" toml:"signingCert"`
+	SigningKey      string `yaml:"signingKey" toml:"signingKey"`
+	SigningPassword string `yaml:"signingPassword" toml:"signingPassword"`
+}
+
+// Limits bounds how much work clients may have the server do.
+type Limits struct {
+	Rate          float64 `yaml:"rate" toml:"rate"`
+	Burst         int     `yaml:"burst" toml:"burst"`
+	DailyCompiles int     `yaml:"dailyCompiles" toml:"dailyCompiles"`
+	DailyStorage  int64   `yaml:"dailyStorage" toml:"dailyStorage"`
+	MaxActiveJobs int     `yaml:"maxActiveJobs" toml:"maxActiveJobs"`
+	MaxQueuedJobs int     `yaml:"maxQueuedJobs" toml:"maxQueuedJobs"`
+	MinFreeSpace  uint64  `yaml:"minFreeSpace" toml:"minFreeSpace"`
+
+	MaxBodySize     int64 `yaml:"maxBodySize" toml:"maxBodySize"`
+	MaxResources    int   `yaml:"maxResources" toml:"maxResources"`
+	MaxResourceSize int64 `yaml:"maxResourceSize" toml:"maxResourceSize"`
+	MaxDetailsDepth int   `yaml:"maxDetailsDepth" toml:"maxDetailsDepth"`
+}
+
+// Database holds the connection settings for the database (assuming LaTTe was compiled with database support).
+type Database struct {
+	Host     string `yaml:"host" toml:"host"`
+	Port     string `yaml:"port" toml:"port"`
+	Name     string `yaml:"name" toml:"name"`
+	Username string `yaml:"username" toml:"username"`
+	Password string `yaml:"password" toml:"password"`
+	SSL      string `yaml:"ssl" toml:"ssl"`
+}
+
+// Duration is a time.Duration that is written as a string such as "30s" in config files.
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(string(text))
+	return err
+}
+
+// Default returns the settings used when nothing else has been configured.
+func Default() *Config {
+	return &Config{
+		Port:              "27182",
+		TemplateCacheSize: 15,
+		CORSOrigins:       []string{"*"},
+		ShutdownGrace:     Duration{30 * time.Second},
+		Log:               Log{Format: "logfmt", Level: "info"},
+		TLS:               TLS{ReloadInterval: Duration{time.Minute}},
+		Job:               Job{Passes: 1, OnMissingKey: "error", LeftDelim: "#!", RightDelim: "!#"},
+		Limits: Limits{
+			MinFreeSpace:    64 << 20,
+			MaxBodySize:     32 << 20,
+			MaxResources:    64,
+			MaxResourceSize: 16 << 20,
+			MaxDetailsDepth: 32,
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the config file, the environment and then args; each overriding
+// the last. The config file is given by the -config flag or else the LATTE_CONFIG environment variable.
+func Load(name string, args []string) (*Config, error) {
+	// Parse the flags once to find the config file and report any bad flags
+	c := Default()
+	fs := c.FlagSet(name)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	path := c.File
+
+	c, err := FromEnv(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Flags take precedence over everything else so apply them last
+	fs = c.FlagSet(name)
+	fs.SetOutput(ioutil.Discard)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	c.File = path
+	return c, nil
+}
+
+// FromEnv builds the configuration from the defaults, the config file at path (if any) and then the environment.
+func FromEnv(path string) (*Config, error) {
+	c := Default()
+	if path != "" {
+		if err := c.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.ReadEnv(); err != nil {
+		return nil, err
+	}
+	c.File = path
+	return c, nil
+}
+
+// FlagSet returns a flag set whose flags write directly into c.
+func (c *Config) FlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&c.File, "config", os.Getenv("LATTE_CONFIG"), "path to a YAML or TOML config `file`")
+	fs.StringVar(&c.Address, "address", c.Address, "the `address` to listen on, all interfaces if empty")
+	fs.StringVar(&c.Port, "port", c.Port, "the `port` to listen on")
+	fs.StringVar(&c.Root, "root", c.Root, "the `directory` to store files in, the user cache directory if empty")
+	fs.IntVar(&c.TemplateCacheSize, "tmpl-cache-size", c.TemplateCacheSize, "how many templates to keep cached in memory")
+	fs.Var((*list)(&c.CORSOrigins), "cors-origins", "comma separated list of `origins` allowed to make cross-origin requests")
+	fs.DurationVar(&c.ShutdownGrace.Duration, "shutdown-grace", c.ShutdownGrace.Duration, "how long running jobs are given to finish on shutdown")
+	fs.StringVar(&c.Log.Format, "log-format", c.Log.Format, "log entry `format`, either logfmt or json")
+	fs.StringVar(&c.Log.Level, "log-level", c.Log.Level, "minimum `level` of log entries to write")
+	fs.StringVar(&c.TraceExporter, "trace-exporter", c.TraceExporter, "where to send traces, either otlp or stdout")
+	fs.StringVar(&c.TLS.CertFile, "tls-cert", c.TLS.CertFile, "PEM encoded certificate `file`, serves HTTPS if set")
+	fs.StringVar(&c.TLS.KeyFile, "tls-key", c.TLS.KeyFile, "PEM encoded private key `file`")
+	fs.DurationVar(&c.TLS.ReloadInterval.Duration, "tls-reload-interval", c.TLS.ReloadInterval.Duration, "how often to check the TLS files for changes; 0 disables reloading")
+	fs.StringVar(&c.TLS.ClientCAFile, "tls-client-ca", c.TLS.ClientCAFile, "PEM encoded CA bundle `file` used to verify client certificates")
+	fs.StringVar(&c.TLS.ClientAuth, "tls-client-auth", c.TLS.ClientAuth, "either request or require a client certificate")
+	fs.StringVar(&c.TLS.ClientIdentitiesFile, "tls-client-identities", c.TLS.ClientIdentitiesFile, "`file` granting scopes to client certificate names")
+	fs.StringVar(&c.Job.Compiler, "compiler", c.Job.Compiler, "default `compiler`, either pdflatex or latexmk")
+	fs.UintVar(&c.Job.Passes, "passes", c.Job.Passes, "default number of compilation passes")
+	fs.StringVar(&c.Job.OnMissingKey, "on-missing-key", c.Job.OnMissingKey, "default missing key `mode`, one of error, zero or nothing")
+	fs.StringVar(&c.Job.LeftDelim, "left-delim", c.Job.LeftDelim, "default left template `delimiter`")
+	fs.StringVar(&c.Job.RightDelim, "right-delim", c.Job.RightDelim, "default right template `delimiter`")
+	fs.StringVar(&c.Job.Sandbox, "sandbox", c.Job.Sandbox, "`sandbox` to run the compiler in, either none or bwrap")
+	fs.StringVar(&c.Job.SigningCert, "signing-cert", c.Job.SigningCert, "PEM encoded certificate or PKCS#12 `file` to sign PDFs with")
+	fs.StringVar(&c.Job.SigningKey, "signing-key", c.Job.SigningKey, "PEM encoded private key `file` for the signing certificate")
+	fs.StringVar(&c.Job.SigningPassword, "signing-password", c.Job.SigningPassword, "`password` of the PKCS#12 signing certificate file")
+	fs.Float64Var(&c.Limits.Rate, "rate-limit", c.Limits.Rate, "requests per second allowed per client, unlimited if 0")
+	fs.IntVar(&c.Limits.Burst, "rate-burst", c.Limits.Burst, "requests a client may make in a burst")
+	fs.IntVar(&c.Limits.DailyCompiles, "daily-compiles", c.Limits.DailyCompiles, "PDFs a client may generate per day, unlimited if 0")
+	fs.Int64Var(&c.Limits.DailyStorage, "daily-storage", c.Limits.DailyStorage, "`bytes` a client may register per day, unlimited if 0")
+	fs.IntVar(&c.Limits.MaxActiveJobs, "max-active-jobs", c.Limits.MaxActiveJobs, "PDFs to compile at once, unlimited if 0")
+	fs.IntVar(&c.Limits.MaxQueuedJobs, "max-queued-jobs", c.Limits.MaxQueuedJobs, "jobs that may wait to be compiled, unlimited if 0")
+	fs.Uint64Var(&c.Limits.MinFreeSpace, "min-free-space", c.Limits.MinFreeSpace, "`bytes` that must be free in the root directory to be ready")
+	fs.Int64Var(&c.Limits.MaxBodySize, "max-body-size", c.Limits.MaxBodySize, "largest request body in `bytes`, unlimited if 0")
+	fs.IntVar(&c.Limits.MaxResources, "max-resources", c.Limits.MaxResources, "most resources a request may include, unlimited if 0")
+	fs.Int64Var(&c.Limits.MaxResourceSize, "max-resource-size", c.Limits.MaxResourceSize, "largest template, resource or registered file in `bytes`, unlimited if 0")
+	fs.IntVar(&c.Limits.MaxDetailsDepth, "max-details-depth", c.Limits.MaxDetailsDepth, "how deeply details may be nested, unlimited if 0")
+	fs.StringVar(&c.Database.Host, "db-host", c.Database.Host, "database `host`")
+	fs.StringVar(&c.Database.Port, "db-port", c.Database.Port, "database `port`")
+	fs.StringVar(&c.Database.Name, "db-name", c.Database.Name, "database `name`")
+	fs.StringVar(&c.Database.Username, "db-username", c.Database.Username, "database `username`")
+	fs.StringVar(&c.Database.Password, "db-password", c.Database.Password, "database `password`")
+	fs.StringVar(&c.Database.SSL, "db-ssl", c.Database.SSL, "database SSL `mode`, either require or disable")
+	return fs
+}
+
+// ReadFile overrides c with the settings in the YAML or TOML file at path, detected by its extension.
+func (c *Config) ReadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, c)
+	case ".toml":
+		var md toml.MetaData
+		md, err = toml.Decode(string(data), c)
+		if err == nil {
+			if undecoded := md.Undecoded(); len(undecoded) > 0 {
+				err = fmt.Errorf("unknown setting %s", undecoded[0])
+			}
+		}
+	default:
+		return fmt.Errorf("config file %s must have a .yaml, .yml or .toml extension", path)
+	}
+	if err != nil {
+		return fmt.Errorf("error while reading config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// ReadEnv overrides c with any settings found in the environment.
+func (c *Config) ReadEnv() error {
+	var errs []string
+	// Variables that are set but empty, as container env files often leave them, are treated as unset
+	str := func(dst *string, key string) {
+		if v := os.Getenv(key); v != "" {
+			*dst = v
+		}
+	}
+	parse := func(key string, fn func(v string) error) {
+		if v := os.Getenv(key); v != "" {
+			if err := fn(v); err != nil {
+				errs = append(errs, fmt.Sprintf("invalid %s: %v", key, err))
+			}
+		}
+	}
+
+	str(&c.Address, "LATTE_ADDRESS")
+	str(&c.Port, "PORT")
+	str(&c.Root, "LATTE_ROOT")
+	parse("LATTE_TMPL_CACHE_SIZE", func(v string) (err error) {
+		c.TemplateCacheSize, err = strconv.Atoi(v)
+		return
+	})
+	parse("LATTE_CORS_ORIGINS", (*list)(&c.CORSOrigins).Set)
+	parse("LATTE_SHUTDOWN_GRACE", func(v string) error {
+		return c.ShutdownGrace.UnmarshalText([]byte(v))
+	})
+	str(&c.Log.Format, "LATTE_LOG_FORMAT")
+	str(&c.Log.Level, "LATTE_LOG_LEVEL")
+	str(&c.TraceExporter, "LATTE_TRACE_EXPORTER")
+
+	str(&c.TLS.CertFile, "LATTE_TLS_CERT_FILE")
+	str(&c.TLS.KeyFile, "LATTE_TLS_KEY_FILE")
+	parse("LATTE_TLS_RELOAD_INTERVAL", func(v string) error {
+		return c.TLS.ReloadInterval.UnmarshalText([]byte(v))
+	})
+	str(&c.TLS.ClientCAFile, "LATTE_TLS_CLIENT_CA_FILE")
+	str(&c.TLS.ClientAuth, "LATTE_TLS_CLIENT_AUTH")
+	str(&c.TLS.ClientIdentitiesFile, "LATTE_TLS_CLIENT_IDENTITIES_FILE")
+
+	str(&c.Job.Compiler, "LATTE_COMPILER")
+	parse("LATTE_PASSES", func(v string) error {
+		n, err := strconv.ParseUint(v, 10, 0)
+		c.Job.Passes = uint(n)
+		return err
+	})
+	str(&c.Job.OnMissingKey, "LATTE_ON_MISSING_KEY")
+	str(&c.Job.LeftDelim, "LATTE_LEFT_DELIM")
+	str(&c.Job.RightDelim, "LATTE_RIGHT_DELIM")
+	str(&c.Job.Sandbox, "LATTE_SANDBOX")
+	str(&c.Job.SigningCert, "LATTE_SIGNING_CERT")
+	str(&c.Job.SigningKey, "LATTE_SIGNING_KEY")
+	str(&c.Job.SigningPassword, "LATTE_SIGNING_PASSWORD")
+
+	parse("LATTE_RATE_LIMIT", func(v string) (err error) {
+		c.Limits.Rate, err = strconv.ParseFloat(v, 64)
+		return
+	})
+	parse("LATTE_RATE_BURST", func(v string) (err error) {
+		c.Limits.Burst, err = strconv.Atoi(v)
+		return
+	})
+	parse("LATTE_DAILY_COMPILES", func(v string) (err error) {
+		c.Limits.DailyCompiles, err = strconv.Atoi(v)
+		return
+	})
+	parse("LATTE_DAILY_STORAGE", func(v string) (err error) {
+		c.Limits.DailyStorage, err = strconv.ParseInt(v, 10, 64)
+		return
+	})
+	parse("LATTE_MAX_ACTIVE_JOBS", func(v string) (err error) {
+		c.Limits.MaxActiveJobs, err = strconv.Atoi(v)
+		return
+	})
+	parse("LATTE_MAX_QUEUED_JOBS", func(v string) (err error) {
+		c.Limits.MaxQueuedJobs, err = strconv.Atoi(v)
+		return
+	})
+	parse("LATTE_MIN_FREE_SPACE", func(v string) (err error) {
+		c.Limits.MinFreeSpace, err = strconv.ParseUint(v, 10, 64)
+		return
+	})
+	parse("LATTE_MAX_BODY_SIZE", func(v string) (err error) {
+		c.Limits.MaxBodySize, err = strconv.ParseInt(v, 10, 64)
+		return
+	})
+	parse("LATTE_MAX_RESOURCES", func(v string) (err error) {
+		c.Limits.MaxResources, err = strconv.Atoi(v)
+		return
+	})
+	parse("LATTE_MAX_RESOURCE_SIZE", func(v string) (err error) {
+		c.Limits.MaxResourceSize, err = strconv.ParseInt(v, 10, 64)
+		return
+	})
+	parse("LATTE_MAX_DETAILS_DEPTH", func(v string) (err error) {
+		c.Limits.MaxDetailsDepth, err = strconv.Atoi(v)
+		return
+	})
+
+	str(&c.Database.Host, "LATTE_DB_HOST")
+	str(&c.Database.Port, "LATTE_DB_PORT")
+	str(&c.Database.Name, "LATTE_DB_NAME")
+	str(&c.Database.Username, "LATTE_DB_USERNAME")
+	str(&c.Database.Password, "LATTE_DB_PASSWORD")
+	str(&c.Database.SSL, "LATTE_DB_SSL")
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Print writes c to w as YAML, or TOML if format is "toml". Secrets are redacted.
+func (c *Config) Print(w io.Writer, format string) error {
+	cc := *c
+	if cc.Database.Password != "" {
+		cc.Database.Password = "REDACTED"
+	}
+	if cc.Job.SigningPassword != "" {
+		cc.Job.SigningPassword = "REDACTED"
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	switch format {
+	case "yaml", "":
+		data, err = yaml.Marshal(&cc)
+	case "toml":
+		var buf bytes.Buffer
+		err = toml.NewEncoder(&buf).Encode(&cc)
+		data = buf.Bytes()
+	default:
+		return fmt.Errorf("invalid config format: %s", format)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// list is a comma separated list of values that can be set from a flag or an environment variable.
+type list []string
+
+func (l *list) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *list) Set(v string) error {
+	*l = nil
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
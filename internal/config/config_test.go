@@ -0,0 +1,203 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "latte-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	yamlFile := filepath.Join(dir, "latte.yaml")
+	err = ioutil.WriteFile(yamlFile, []byte(`
+port: "8000"
+root: /srv/latte
+corsOrigins: [https://a.example.com, https://b.example.com]
+shutdownGrace: 1m
+job:
+  compiler: pdflatex
+limits:
+  rate: 5
+  maxActiveJobs: 4
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tomlFile := filepath.Join(dir, "latte.toml")
+	err = ioutil.WriteFile(tomlFile, []byte(`
+port = "8000"
+root = "/srv/latte"
+corsOrigins = ["https://a.example.com", "https://b.example.com"]
+shutdownGrace = "1m"
+
+[job]
+compiler = "pdflatex"
+
+[limits]
+rate = 5.0
+maxActiveJobs = 4
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	badFile := filepath.Join(dir, "bad.yaml")
+	if err = ioutil.WriteFile(badFile, []byte("prot: 8000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fromFile := func() *Config {
+		c := Default()
+		c.Port = "8000"
+		c.Root = "/srv/latte"
+		c.CORSOrigins = []string{"https://a.example.com", "https://b.example.com"}
+		c.ShutdownGrace = Duration{time.Minute}
+		c.Job.Compiler = "pdflatex"
+		c.Limits.Rate = 5
+		c.Limits.MaxActiveJobs = 4
+		return c
+	}
+
+	tt := []struct {
+		Name       string
+		Env        map[string]string
+		Args       []string
+		ShouldFail bool
+		Expected   *Config
+	}{
+		{
+			Name:     "Defaults",
+			Expected: Default(),
+		},
+		{
+			Name:     "YAML file",
+			Args:     []string{"-config", yamlFile},
+			Expected: fromFile(),
+		},
+		{
+			Name:     "TOML file",
+			Env:      map[string]string{"LATTE_CONFIG": tomlFile},
+			Expected: fromFile(),
+		},
+		{
+			Name: "Environment overrides file",
+			Env:  map[string]string{"PORT": "9000", "LATTE_CORS_ORIGINS": "https://c.example.com"},
+			Args: []string{"-config", yamlFile},
+			Expected: func() *Config {
+				c := fromFile()
+				c.Port = "9000"
+				c.CORSOrigins = []string{"https://c.example.com"}
+				return c
+			}(),
+		},
+		{
+			Name: "Flags override environment",
+			Env:  map[string]string{"PORT": "9000", "LATTE_RATE_LIMIT": "10"},
+			Args: []string{"-config", yamlFile, "-port", "9001", "-address", "127.0.0.1"},
+			Expected: func() *Config {
+				c := fromFile()
+				c.Address = "127.0.0.1"
+				c.Port = "9001"
+				c.Limits.Rate = 10
+				return c
+			}(),
+		},
+		{
+			Name:     "Empty environment variables are ignored",
+			Env:      map[string]string{"PORT": "", "LATTE_ROOT": ""},
+			Args:     []string{"-config", yamlFile},
+			Expected: fromFile(),
+		},
+		{
+			Name:       "Unknown setting in file",
+			Args:       []string{"-config", badFile},
+			ShouldFail: true,
+		},
+		{
+			Name:       "Invalid environment variable",
+			Env:        map[string]string{"LATTE_MAX_ACTIVE_JOBS": "lots"},
+			ShouldFail: true,
+		},
+		{
+			Name:       "Unknown flag",
+			Args:       []string{"-prot", "9000"},
+			ShouldFail: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			for k, v := range tc.Env {
+				os.Setenv(k, v)
+				defer os.Unsetenv(k)
+			}
+
+			c, err := Load("test", tc.Args)
+			if tc.ShouldFail {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c.File = ""
+			if !reflect.DeepEqual(c, tc.Expected) {
+				t.Errorf("expected config %+v, got %+v", tc.Expected, c)
+			}
+		})
+	}
+}
+
+func TestConfig_Print(t *testing.T) {
+	dir, err := ioutil.TempDir("", "latte-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := Default()
+	c.Root = "/srv/latte"
+	c.Database.Password = "hunter2"
+	c.Job.SigningPassword = "hunter3"
+
+	// What gets printed should be readable as a config file
+	for _, format := range []string{"yaml", "toml"} {
+		var buf bytes.Buffer
+		if err := c.Print(&buf, format); err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(buf.Bytes(), []byte("hunter2")) {
+			t.Fatalf("%s output contains the database password", format)
+		}
+		if bytes.Contains(buf.Bytes(), []byte("hunter3")) {
+			t.Fatalf("%s output contains the signing password", format)
+		}
+
+		path := filepath.Join(dir, "latte."+format)
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		read := Default()
+		if err := read.ReadFile(path); err != nil {
+			t.Fatal(err)
+		}
+		read.Database.Password = c.Database.Password
+		read.Job.SigningPassword = c.Job.SigningPassword
+		if !reflect.DeepEqual(read, c) {
+			t.Errorf("expected %s round trip to give %+v, got %+v", format, c, read)
+		}
+	}
+}
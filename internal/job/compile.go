@@ -1,25 +1,35 @@
 package job
 
 import (
+	"bytes"
 	"context"
 	"io/ioutil"
-	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/raphaelreyna/latte/internal/logging"
+	"github.com/raphaelreyna/latte/internal/metrics"
+	"github.com/raphaelreyna/latte/internal/tracing"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Compile creates a tex file by filling in the template with the details and then compiles
-// the results and returns the location of the resulting PDF.
-func (j *Job) Compile(ctx context.Context) (string, error) {
-	opts := j.Opts
+// the results and returns the location of the resulting PDF, or whichever format the options call for.
+// Paged formats produce a file per page; all of them are listed in Outputs and the first is returned.
+func (j *Job) Compile(ctx context.Context) (pdf string, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Job.Compile")
+	defer func() {
+		if err != nil {
+			tracing.Fail(span, err)
+		}
+		span.End()
+	}()
 
-	// Move into the working directory
-	currDir, err := os.Getwd()
-	if err != nil {
-		return "", err
-	}
-	os.Chdir(j.Root)
-	defer os.Chdir(currDir)
+	opts := j.Opts
+	metrics.JobsActive.Inc()
+	defer metrics.JobsActive.Dec()
 
 	// Grab a valid compiler from the options
 	compiler := string(CC_Default)
@@ -28,57 +38,173 @@ func (j *Job) Compile(ctx context.Context) (string, error) {
 	}
 
 	// Create the jobname from the options
-	jn := filepath.Base(j.Root)
+	jn := j.jobName()
 	if opts.N < 1 {
 		opts.N = 1
 	}
+	span.SetAttributes(
+		attribute.String("latte.compiler", compiler),
+		attribute.Int("latte.passes", int(opts.N)),
+		attribute.String("latte.output", opts.Output.Ext()),
+		attribute.String("latte.conformance", string(opts.Conformance)),
+		attribute.Bool("latte.reproducible", opts.Reproducible),
+	)
 
-	// Create the tex file
-	texFile, err := ioutil.TempFile(j.Root, "*_filled-in.tex")
-	if err != nil {
-		return "", err
-	}
-	defer func() {
-		texFile.Close()
-		//os.Remove(texFile.Name())
-	}()
-
-	tmpl := j.Template.Option("missingkey=" + j.Opts.OnMissingKey.Val())
-	err = tmpl.Execute(texFile, j.Details)
-	if err != nil {
+	// Create the tex file along with the resources it needs
+	if err = j.Fill(ctx); err != nil {
 		return "", err
 	}
 
 	// Compile however many times the user asked for
+	log := logging.FromContext(ctx).WithFields(logrus.Fields{"compiler": compiler, "passes": opts.N})
+	start := time.Now()
 	for count := uint(0); count < opts.N; count++ {
 		// Make sure the context hasn't been canceled
 		if err := ctx.Err(); err != nil {
+			countFailure(ctx, metrics.FailureCanceled)
 			return "", err
 		}
 
-		args := []string{"-halt-on-error", "-jobname=" + jn}
-		if opts.CC == CC_Latexmk {
+		args := []string{"-halt-on-error", "-no-shell-escape", "-jobname=" + jn}
+		if compiler == string(CC_Latexmk) {
+			// latexmk runs any latexmkrc in the job's directory as Perl, which the template could have written
+			args = append(args, "-norc")
+		}
+		switch {
+		case opts.CC == CC_Latexmk && opts.Output.viaDVI():
+			args = append(args, "-dvi")
+		case opts.CC == CC_Latexmk:
 			args = append(args, "-pdf")
+		case opts.Output.viaDVI():
+			args = append(args, "-output-format=dvi")
 		}
-		args = append(args, texFile.Name())
-		// Create a handle for the compiler command
-		cmd := exec.CommandContext(ctx, compiler, args...)
-
-		switch count {
-		case opts.N - 1: // capture the error on the last run
-			// Run command and grab its output and log it
-			result, err := cmd.Output()
-			if err != nil {
-				return string(result), err
-			}
-		default:
-			if err = cmd.Start(); err != nil {
-				return "", err
-			}
-			if err = cmd.Wait(); err != nil {
-				return "", err
-			}
+		args = append(args, j.TexFile)
+		log.WithField("pass", count+1).Debug("running compiler")
+		if result, err := j.compilePass(ctx, compiler, args, count+1, count == opts.N-1); err != nil {
+			countFailure(ctx, metrics.FailureCompiler)
+			return result, err
 		}
 	}
-	return jn + ".pdf", nil
+	elapsed := time.Since(start)
+	metrics.CompileDuration.WithLabelValues(compiler, strconv.Itoa(int(opts.N))).Observe(elapsed.Seconds())
+	log.WithFields(logrus.Fields{"duration": elapsed, "output": opts.Output.Ext()}).Info("compiled template")
+
+	// Convert into whichever format was asked for
+	if result, err := j.convert(ctx, jn); err != nil {
+		return result, err
+	}
+	// Make sure pdfx did its job
+	if err = CheckConformance(filepath.Join(j.Root, j.Outputs[0]), opts.Conformance); err != nil {
+		countFailure(ctx, metrics.FailureConformance)
+		return "", err
+	}
+	// Stamp before encrypting or signing, which have to come last
+	if err = j.stamp(ctx, filepath.Join(j.Root, j.Outputs[0])); err != nil {
+		return "", err
+	}
+	if err = j.encrypt(ctx, filepath.Join(j.Root, j.Outputs[0])); err != nil {
+		return "", err
+	}
+	if err = j.sign(ctx, filepath.Join(j.Root, j.Outputs[0])); err != nil {
+		return "", err
+	}
+	return j.Outputs[0], nil
+}
+
+// Fill makes sure all of the resources are in the working directory and creates the tex file in it by filling in the
+// template with the details, storing its location in TexFile.
+// The packages needed for the metadata and conformance level in the options, if any, are added as well, along with a
+// fixed trailer ID if the output should be reproducible.
+func (j *Job) Fill(ctx context.Context) error {
+	if err := j.linkResources(ctx); err != nil {
+		countFailure(ctx, metrics.FailureIO)
+		return err
+	}
+
+	texFile, err := ioutil.TempFile(j.Root, "*_filled-in.tex")
+	if err != nil {
+		countFailure(ctx, metrics.FailureIO)
+		return err
+	}
+	defer texFile.Close()
+	j.TexFile = texFile.Name()
+
+	_, span := tracing.Tracer().Start(ctx, "Template.Execute")
+	defer span.End()
+	tmpl := j.Template.Option("missingkey=" + j.Opts.OnMissingKey.Val())
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, j.Details); err != nil {
+		tracing.Fail(span, err)
+		countFailure(ctx, metrics.FailureTemplate)
+		return err
+	}
+	md, err := j.fillMetadata()
+	if err != nil {
+		tracing.Fail(span, err)
+		countFailure(ctx, metrics.FailureTemplate)
+		return err
+	}
+	// pdfx takes care of the metadata when it's used to make the PDF conform to a standard
+	tex := buf.Bytes()
+	if j.Opts.Conformance != CF_None {
+		tex, err = j.addConformance(tex, j.jobName(), md)
+	} else {
+		tex, err = addMetadata(tex, md)
+	}
+	if err != nil {
+		tracing.Fail(span, err)
+		countFailure(ctx, metrics.FailureTemplate)
+		return err
+	}
+	if j.Opts.Reproducible {
+		tex = addTrailerID(tex)
+	}
+	if _, err = texFile.Write(tex); err != nil {
+		countFailure(ctx, metrics.FailureIO)
+		return err
+	}
+	return nil
+}
+
+// compilePass runs the compiler once with the given args.
+// The compilers output is captured and returned if this is the last pass.
+func (j *Job) compilePass(ctx context.Context, compiler string, args []string, pass uint, last bool) (string, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "compile pass")
+	span.SetAttributes(attribute.Int("latte.pass", int(pass)))
+	defer span.End()
+
+	// Create a handle for the compiler command, sandboxed if need be
+	cmd, err := j.command(ctx, compiler, args)
+	if err != nil {
+		tracing.Fail(span, err)
+		return "", err
+	}
+
+	if last { // capture the error on the last run
+		// Run command and grab its output and log it
+		result, err := cmd.Output()
+		if err != nil {
+			tracing.Fail(span, err)
+			return string(result), err
+		}
+		return "", nil
+	}
+
+	if err := cmd.Start(); err != nil {
+		tracing.Fail(span, err)
+		return "", err
+	}
+	if err := cmd.Wait(); err != nil {
+		tracing.Fail(span, err)
+		return "", err
+	}
+	return "", nil
+}
+
+// countFailure records a failed compilation under category, unless it failed because ctx was canceled.
+func countFailure(ctx context.Context, category string) {
+	if ctx.Err() != nil {
+		category = metrics.FailureCanceled
+	}
+	metrics.CompileFailures.WithLabelValues(category).Inc()
 }
@@ -0,0 +1,183 @@
+package job
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+)
+
+// Conformance is a PDF standard the compiled PDF should conform to.
+type Conformance string
+
+var (
+	// CF_None leaves the PDF as the template makes it.
+	CF_None Conformance = ""
+	// CF_PDFA2b makes an archival PDF/A-2b document.
+	CF_PDFA2b Conformance = "pdfa-2b"
+	// CF_PDFX1a makes a PDF/X-1a print document, in which all colors are CMYK.
+	CF_PDFX1a Conformance = "pdfx-1a"
+	// CF_PDFX4 makes a PDF/X-4 print document.
+	CF_PDFX4 Conformance = "pdfx-4"
+)
+
+func (cf Conformance) IsValid() bool {
+	return cf == CF_None || cf == CF_PDFA2b || cf == CF_PDFX1a || cf == CF_PDFX4
+}
+
+// pdfxOption returns the option to load the pdfx package with for the conformance level.
+func (cf Conformance) pdfxOption() string {
+	switch cf {
+	case CF_PDFA2b:
+		return "a-2b"
+	case CF_PDFX1a:
+		return "x-1a"
+	case CF_PDFX4:
+		return "x-4"
+	}
+	return ""
+}
+
+// String returns the name of the standard, e.g. PDF/A-2b.
+func (cf Conformance) String() string {
+	switch cf {
+	case CF_PDFA2b:
+		return "PDF/A-2b"
+	case CF_PDFX1a:
+		return "PDF/X-1a"
+	case CF_PDFX4:
+		return "PDF/X-4"
+	}
+	return string(cf)
+}
+
+// conformanceMarker is something a PDF conforming to a standard must contain, described by what.
+type conformanceMarker struct {
+	what    string
+	pattern *regexp.Regexp
+}
+
+// conformanceMarkers are what a PDF conforming to each standard must contain.
+// pdfx writes them into the document's output intent, info dictionary and XMP metadata.
+var conformanceMarkers = map[Conformance][]conformanceMarker{
+	CF_PDFA2b: {
+		{"a PDF/A output intent", regexp.MustCompile(`/S\s*/GTS_PDFA1\b`)},
+		{"the PDF/A part in its XMP metadata", regexp.MustCompile(`pdfaid:part(="|>)2\b`)},
+		{"the PDF/A conformance level in its XMP metadata", regexp.MustCompile(`pdfaid:conformance(="|>)B\b`)},
+	},
+	CF_PDFX1a: {
+		{"a PDF/X output intent", regexp.MustCompile(`/S\s*/GTS_PDFX\b`)},
+		{"the PDF/X conformance level in its info dictionary", regexp.MustCompile(`/GTS_PDFXConformance\s*\(PDF/X-1a:`)},
+	},
+	CF_PDFX4: {
+		{"a PDF/X output intent", regexp.MustCompile(`/S\s*/GTS_PDFX\b`)},
+		{"the PDF/X version in its info dictionary", regexp.MustCompile(`/GTS_PDFXVersion\s*\(PDF/X-4`)},
+	},
+}
+
+// documentClassPattern matches the \documentclass command along with its options and optional release date.
+var documentClassPattern = regexp.MustCompile(`\\documentclass\s*(\[[^\]]*\]\s*)?\{[^}]*\}(\s*\[[^\]]*\])?`)
+
+// titlePattern matches a simple \title, without any groups in it.
+var titlePattern = regexp.MustCompile(`\\title\s*\{([^{}]*)\}`)
+
+// addConformance loads the pdfx package right after the \documentclass in the filled-in tex, as pdfx needs to be
+// loaded before anything else, and writes the metadata md for pdfx to read into the working directory for the job
+// named jn.
+func (j *Job) addConformance(tex []byte, jn string, md Metadata) ([]byte, error) {
+	cf := j.Opts.Conformance
+	if cf == CF_None {
+		return tex, nil
+	}
+	if bytes.Contains(tex, []byte("{pdfx}")) {
+		return nil, fmt.Errorf("template loads the pdfx package itself; remove it to produce %s", cf)
+	}
+	loc := documentClassPattern.FindIndex(tex)
+	if loc == nil {
+		return nil, fmt.Errorf("template has no \\documentclass to load the pdfx package after for %s", cf)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(tex[:loc[1]])
+	fmt.Fprintf(&buf, "\n\\usepackage[%s]{pdfx}", cf.pdfxOption())
+	buf.Write(tex[loc[1]:])
+
+	// pdfx reads the document's metadata from \jobname.xmpdata, which PDF/X requires a title in
+	xmp := xmpData(md)
+	if md.Title == "" {
+		title := "Untitled"
+		if m := titlePattern.FindSubmatch(tex); m != nil && len(bytes.TrimSpace(m[1])) > 0 {
+			title = string(bytes.TrimSpace(m[1]))
+		}
+		xmp = fmt.Sprintf("\\Title{%s}\n", title) + xmp
+	}
+	if err := ioutil.WriteFile(filepath.Join(j.Root, jn+".xmpdata"), []byte(xmp), 0644); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// CheckConformance returns an error if the PDF at path is missing any of the markers that a PDF conforming to cf
+// contains. It doesn't validate the PDF against the standard, only that it claims to conform to it.
+func CheckConformance(path string, cf Conformance) error {
+	markers := conformanceMarkers[cf]
+	if len(markers) == 0 {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	data = append(data, inflateStreams(data)...)
+	for _, m := range markers {
+		if !m.pattern.Match(data) {
+			return fmt.Errorf("compiled PDF isn't %s conformant: it's missing %s", cf, m.what)
+		}
+	}
+	return nil
+}
+
+var (
+	streamPattern = regexp.MustCompile(`stream\r?\n`)
+	objPattern    = regexp.MustCompile(`\d+\s+\d+\s+obj\b`)
+)
+
+// inflateStreams returns the decompressed contents of the object and metadata streams in the PDF data, in which
+// the markers checked by CheckConformance may be hidden.
+func inflateStreams(data []byte) []byte {
+	var out []byte
+	objs := objPattern.FindAllIndex(data, -1)
+	var obj int
+	for _, loc := range streamPattern.FindAllIndex(data, -1) {
+		if bytes.HasSuffix(data[:loc[0]], []byte("end")) {
+			continue
+		}
+		// The stream's dictionary lies between the start of its object and the stream keyword
+		for obj+1 < len(objs) && objs[obj+1][1] <= loc[0] {
+			obj++
+		}
+		if len(objs) == 0 || objs[obj][1] > loc[0] {
+			continue
+		}
+		dict := data[objs[obj][1]:loc[0]]
+		if !bytes.Contains(dict, []byte("/FlateDecode")) ||
+			!(bytes.Contains(dict, []byte("/ObjStm")) || bytes.Contains(dict, []byte("/Metadata"))) {
+			continue
+		}
+		end := bytes.Index(data[loc[1]:], []byte("endstream"))
+		if end < 0 {
+			continue
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(data[loc[1] : loc[1]+end]))
+		if err != nil {
+			continue
+		}
+		// Whatever could be inflated is kept, even if the stream turns out to be truncated
+		inflated, _ := ioutil.ReadAll(zr)
+		out = append(out, inflated...)
+		out = append(out, '\n')
+	}
+	return out
+}
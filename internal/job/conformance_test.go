@@ -0,0 +1,170 @@
+package job
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJob_addConformance(t *testing.T) {
+	tt := []struct {
+		Name        string
+		Conformance Conformance
+		Tex         string
+		Expected    string
+		Title       string
+		Error       string
+	}{
+		{
+			Name:     "None",
+			Tex:      "\\documentclass{article}\n",
+			Expected: "\\documentclass{article}\n",
+		},
+		{
+			Name:        "PDF/A",
+			Conformance: CF_PDFA2b,
+			Tex:         "\\documentclass[a4paper, 12pt]{article}[2020/01/01]\n\\title{Invoice \\#3}\n",
+			Expected:    "\\documentclass[a4paper, 12pt]{article}[2020/01/01]\n\\usepackage[a-2b]{pdfx}\n\\title{Invoice \\#3}\n",
+			Title:       "Invoice \\#3",
+		},
+		{
+			Name:        "PDF/X without a title",
+			Conformance: CF_PDFX4,
+			Tex:         "% comment\n\\documentclass {report}\n\\begin{document}\n",
+			Expected:    "% comment\n\\documentclass {report}\n\\usepackage[x-4]{pdfx}\n\\begin{document}\n",
+			Title:       "Untitled",
+		},
+		{
+			Name:        "No document class",
+			Conformance: CF_PDFX1a,
+			Tex:         "Hello",
+			Error:       "no \\documentclass",
+		},
+		{
+			Name:        "Loads pdfx",
+			Conformance: CF_PDFA2b,
+			Tex:         "\\documentclass{article}\n\\usepackage[a-1b]{pdfx}\n",
+			Error:       "loads the pdfx package itself",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "latte-job")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(root)
+			j := NewJob(root, nil)
+			j.Opts.Conformance = tc.Conformance
+
+			tex, err := j.addConformance([]byte(tc.Tex), "job", Metadata{})
+			if tc.Error != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.Error) {
+					t.Fatalf("expected error containing %q, got %v", tc.Error, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(tex) != tc.Expected {
+				t.Errorf("expected tex %q, got %q", tc.Expected, tex)
+			}
+
+			xmp, err := ioutil.ReadFile(filepath.Join(root, "job.xmpdata"))
+			if tc.Title == "" {
+				if !os.IsNotExist(err) {
+					t.Errorf("expected no xmpdata file, got %q, %v", xmp, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := "\\Title{" + tc.Title + "}\n"; string(xmp) != expected {
+				t.Errorf("expected xmpdata %q, got %q", expected, xmp)
+			}
+		})
+	}
+}
+
+func TestCheckConformance(t *testing.T) {
+	const xmp = `<rdf:Description rdf:about="" xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/">` +
+		`<pdfaid:part>2</pdfaid:part><pdfaid:conformance>B</pdfaid:conformance></rdf:Description>`
+	const intent = "<< /Type /OutputIntent /S /GTS_PDFA1 /OutputConditionIdentifier (sRGB) >>"
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write([]byte("12 0 " + intent))
+	zw.Close()
+
+	tt := []struct {
+		Name        string
+		Conformance Conformance
+		PDF         string
+		Error       string
+	}{
+		{
+			Name:        "Uncompressed",
+			Conformance: CF_PDFA2b,
+			PDF:         fmt.Sprintf("%%PDF-1.7\n3 0 obj\n%s\nendobj\n4 0 obj\n<< /Type /Metadata /Length %d >>\nstream\n%s\nendstream\nendobj\n", intent, len(xmp), xmp),
+		},
+		{
+			Name:        "Object stream",
+			Conformance: CF_PDFA2b,
+			PDF: fmt.Sprintf("%%PDF-1.7\n4 0 obj\n<< /Type /Metadata /Length %d >>\nstream\n%s\nendstream\nendobj\n"+
+				"5 0 obj\n<< /Type /ObjStm /N 1 /First 5 /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream\nendobj\n",
+				len(xmp), xmp, compressed.Len(), compressed.Bytes()),
+		},
+		{
+			Name:        "Missing metadata",
+			Conformance: CF_PDFA2b,
+			PDF:         fmt.Sprintf("%%PDF-1.7\n3 0 obj\n%s\nendobj\n", intent),
+			Error:       "isn't PDF/A-2b conformant: it's missing the PDF/A part in its XMP metadata",
+		},
+		{
+			Name:        "PDF/X",
+			Conformance: CF_PDFX1a,
+			PDF: "%PDF-1.3\n1 0 obj\n<< /GTS_PDFXVersion (PDF/X-1:2001) /GTS_PDFXConformance (PDF/X-1a:2001) >>\nendobj\n" +
+				"2 0 obj\n<< /Type /OutputIntent /S/GTS_PDFX >>\nendobj\n",
+		},
+		{
+			Name:        "Wrong PDF/X version",
+			Conformance: CF_PDFX4,
+			PDF: "%PDF-1.3\n1 0 obj\n<< /GTS_PDFXVersion (PDF/X-1:2001) >>\nendobj\n" +
+				"2 0 obj\n<< /Type /OutputIntent /S /GTS_PDFX >>\nendobj\n",
+			Error: "isn't PDF/X-4 conformant: it's missing the PDF/X version in its info dictionary",
+		},
+		{
+			Name: "None",
+			PDF:  "%PDF-1.5\n",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "latte-*.pdf")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(f.Name())
+			f.WriteString(tc.PDF)
+			f.Close()
+
+			err = CheckConformance(f.Name(), tc.Conformance)
+			if tc.Error == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.Error) {
+				t.Fatalf("expected error containing %q, got %v", tc.Error, err)
+			}
+		})
+	}
+}
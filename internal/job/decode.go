@@ -0,0 +1,189 @@
+package job
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// RequestLimits bounds the size of requests decoded by DecodeRequest; zero values are unlimited.
+type RequestLimits struct {
+	// MaxBodySize is the most bytes that will be read from the request body.
+	MaxBodySize int64
+	// MaxResources is the most resources a request may include.
+	MaxResources int
+	// MaxResourceSize is the largest a resource, or the template, may be once decoded, in bytes.
+	MaxResourceSize int64
+	// MaxDetailsDepth is how deeply objects and arrays in the details may be nested.
+	MaxDetailsDepth int
+}
+
+// LimitError is returned when a request exceeds one of the limits it's decoded with.
+type LimitError struct {
+	Message string
+}
+
+func (e *LimitError) Error() string {
+	return e.Message
+}
+
+func limitErrorf(format string, a ...interface{}) error {
+	return &LimitError{Message: fmt.Sprintf(format, a...)}
+}
+
+// LimitReader reads from r, failing with a *LimitError once more than n bytes have been read.
+// If n isn't positive, r is returned as is.
+func LimitReader(r io.Reader, n int64) io.Reader {
+	if n <= 0 {
+		return r
+	}
+	return &limitedReader{r: r, n: n, limit: n}
+}
+
+type limitedReader struct {
+	r     io.Reader
+	n     int64
+	limit int64
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if lr.n < 0 {
+		return 0, limitErrorf("request body is larger than the limit of %d bytes", lr.limit)
+	}
+	// Read one byte past the limit to tell a body that's exactly at the limit from one that's over it
+	if int64(len(p)) > lr.n+1 {
+		p = p[:lr.n+1]
+	}
+	n, err := lr.r.Read(p)
+	if int64(n) > lr.n {
+		// Hold back the extra byte so that the error is seen as soon as it's needed
+		n, lr.n = int(lr.n), -1
+		return n, limitErrorf("request body is larger than the limit of %d bytes", lr.limit)
+	}
+	lr.n -= int64(n)
+	return n, err
+}
+
+// DecodeRequest decodes a JSON encoded Request from r, enforcing l as it goes so that oversized requests are turned
+// away without being read into memory past l.MaxBodySize.
+// Exceeding a limit results in a *LimitError.
+func DecodeRequest(r io.Reader, l RequestLimits) (*Request, error) {
+	req := &Request{}
+	// The limited fields shadow the Request's own, everything else is decoded into it as usual
+	lreq := struct {
+		*Request
+		Resources limitedResources `json:"resources"`
+		Details   limitedDetails   `json:"details"`
+	}{
+		Request:   req,
+		Resources: limitedResources{rscs: &req.Resources, limits: l},
+		Details:   limitedDetails{dtls: &req.Details, limits: l},
+	}
+	if err := json.NewDecoder(LimitReader(r, l.MaxBodySize)).Decode(&lreq); err != nil {
+		return nil, err
+	}
+	if max := l.MaxResourceSize; max > 0 && Base64Size(req.Template) > max {
+		return nil, limitErrorf("template is larger than the limit of %d bytes", max)
+	}
+	return req, nil
+}
+
+// Resources maps the names of a request's resource files to their base64 encoded contents.
+type Resources map[string]string
+
+func (rs *Resources) UnmarshalJSON(data []byte) error {
+	return rs.decode(data, RequestLimits{})
+}
+
+func (rs *Resources) decode(data []byte, l RequestLimits) error {
+	var m map[string]string
+	if err := json.Unmarshal(data, &m); err != nil {
+		return errors.New("resources must be an object mapping names to base64 encoded contents")
+	}
+	if max := l.MaxResources; max > 0 && len(m) > max {
+		return limitErrorf("request has more than the limit of %d resources", max)
+	}
+	if max := l.MaxResourceSize; max > 0 {
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if Base64Size(m[name]) > max {
+				return limitErrorf("resource %q is larger than the limit of %d bytes", name, max)
+			}
+		}
+	}
+	*rs = m
+	return nil
+}
+
+// Details are what a request's template is filled in with.
+type Details map[string]interface{}
+
+func (d *Details) UnmarshalJSON(data []byte) error {
+	return d.decode(data, RequestLimits{})
+}
+
+func (d *Details) decode(data []byte, l RequestLimits) error {
+	if max := l.MaxDetailsDepth; max > 0 && jsonDepth(data) > max {
+		return limitErrorf("details are nested deeper than the limit of %d levels", max)
+	}
+	return json.Unmarshal(data, (*map[string]interface{})(d))
+}
+
+// limitedResources and limitedDetails decode into the Resources and Details they point to, enforcing limits.
+type limitedResources struct {
+	rscs   *Resources
+	limits RequestLimits
+}
+
+func (lr *limitedResources) UnmarshalJSON(data []byte) error {
+	return lr.rscs.decode(data, lr.limits)
+}
+
+type limitedDetails struct {
+	dtls   *Details
+	limits RequestLimits
+}
+
+func (ld *limitedDetails) UnmarshalJSON(data []byte) error {
+	return ld.dtls.decode(data, ld.limits)
+}
+
+// Base64Size returns how many bytes the base64 encoded string s decodes to, assuming it's valid.
+func Base64Size(s string) int64 {
+	n := int64(base64.StdEncoding.DecodedLen(len(s)))
+	for i := len(s) - 1; i >= 0 && s[i] == '='; i-- {
+		n--
+	}
+	return n
+}
+
+// jsonDepth returns how deeply objects and arrays are nested in data, which must be valid JSON.
+func jsonDepth(data []byte) int {
+	var depth, max int
+	var inString, escaped bool
+	for _, c := range data {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{' || c == '[':
+			if depth++; depth > max {
+				max = depth
+			}
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+	return max
+}
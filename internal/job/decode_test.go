@@ -0,0 +1,92 @@
+package job
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeRequest(t *testing.T) {
+	body := `{
+		"template": "SGVsbG8=",
+		"details": {"name": "Alice", "items": [{"price": 1}]},
+		"resources": {"logo.png": "cG5n", "font.ttf": "dHRm"},
+		"delimiters": {"left": "<<", "right": ">>"},
+		"OnMissingKey": "zero",
+		"compiler": "latexmk",
+		"count": 2,
+		"render": "tex",
+		"output": "png",
+		"dpi": 300,
+		"pages": "1-2",
+		"metadata": {"title": "Invoice", "keywords": ["a", "b"]},
+		"unknown": [1, 2, 3]
+	}`
+	expected := &Request{
+		Template:     "SGVsbG8=",
+		Details:      map[string]interface{}{"name": "Alice", "items": []interface{}{map[string]interface{}{"price": 1.0}}},
+		Resources:    map[string]string{"logo.png": "cG5n", "font.ttf": "dHRm"},
+		Delimiters:   Delimiters{Left: "<<", Right: ">>"},
+		OnMissingKey: MK_Zero,
+		Compiler:     CC_Latexmk,
+		Count:        2,
+		Render:       RM_Tex,
+		Output:       OF_PNG,
+		DPI:          300,
+		Pages:        "1-2",
+		Metadata:     Metadata{Title: "Invoice", Keywords: []string{"a", "b"}},
+	}
+	req, err := DecodeRequest(strings.NewReader(body), RequestLimits{
+		MaxBodySize:     int64(len(body)),
+		MaxResources:    2,
+		MaxResourceSize: 5,
+		MaxDetailsDepth: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(req, expected) {
+		t.Errorf("expected %+v, got %+v", expected, req)
+	}
+
+	tt := []struct {
+		Name   string
+		Body   string
+		Limits RequestLimits
+	}{
+		{Name: "Body too large", Body: body, Limits: RequestLimits{MaxBodySize: int64(len(body)) - 1}},
+		{Name: "Too many resources", Body: `{"resources": {"a": "", "b": "", "c": ""}}`, Limits: RequestLimits{MaxResources: 2}},
+		{Name: "Resource too large", Body: `{"resources": {"a": "cG5ncG5u"}}`, Limits: RequestLimits{MaxResourceSize: 5}},
+		{Name: "Template too large", Body: `{"template": "cG5ncG5u"}`, Limits: RequestLimits{MaxResourceSize: 5}},
+		{Name: "Details too deep", Body: `{"details": {"a": [{"b": "[[[{"}]}}`, Limits: RequestLimits{MaxDetailsDepth: 2}},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := DecodeRequest(strings.NewReader(tc.Body), tc.Limits)
+			if _, ok := err.(*LimitError); !ok {
+				t.Errorf("expected a *LimitError, got %v", err)
+			}
+		})
+	}
+
+	if _, err := DecodeRequest(strings.NewReader(`{"resources": ["a"]}`), RequestLimits{}); err == nil {
+		t.Error("expected an error decoding resources that aren't an object")
+	} else if _, ok := err.(*LimitError); ok {
+		t.Error("expected a malformed request not to be reported as exceeding a limit")
+	}
+}
+
+func TestJSONDepth(t *testing.T) {
+	tt := map[string]int{
+		`"a"`:                          0,
+		`{}`:                           1,
+		`{"a": [1, {"b": null}]}`:      3,
+		`{"a": "{[{[", "b": "\"{"}`:    1,
+		`[[], [[]], {"a": {"b": {}}}]`: 4,
+	}
+	for data, expected := range tt {
+		if depth := jsonDepth([]byte(data)); depth != expected {
+			t.Errorf("expected depth of %s to be %d, got %d", data, expected, depth)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package job
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/raphaelreyna/latte/internal/metrics"
+	"github.com/raphaelreyna/latte/internal/tracing"
+)
+
+// pdfcpu would otherwise create a config directory in the user's home, exiting if it can't.
+func init() {
+	api.DisableConfigDir()
+}
+
+// Permission is something readers of an encrypted PDF can be denied.
+type Permission string
+
+var (
+	// PM_Print denies printing.
+	PM_Print Permission = "print"
+	// PM_Modify denies changing the contents of the document.
+	PM_Modify Permission = "modify"
+	// PM_Copy denies copying or otherwise extracting text and graphics, except for accessibility.
+	PM_Copy Permission = "copy"
+	// PM_Annotate denies adding or changing annotations and filling in forms.
+	PM_Annotate Permission = "annotate"
+	// PM_FillForms denies filling in forms.
+	PM_FillForms Permission = "fill-forms"
+	// PM_Assemble denies inserting, rotating or deleting pages and creating bookmarks or thumbnails.
+	PM_Assemble Permission = "assemble"
+)
+
+// permissionBits are the bits, numbered from 1 as in the PDF specification, that grant each permission.
+var permissionBits = map[Permission][]uint{
+	PM_Print:     {3, 12},
+	PM_Modify:    {4},
+	PM_Copy:      {5},
+	PM_Annotate:  {6},
+	PM_FillForms: {9},
+	PM_Assemble:  {11},
+}
+
+func (p Permission) IsValid() bool {
+	_, ok := permissionBits[p]
+	return ok
+}
+
+// Encryption holds the options for encrypting the compiled PDF.
+type Encryption struct {
+	// UserPassword is needed to open the PDF; if it's empty, anyone can open it but the permissions still apply.
+	// It's filled in with the details so that each recipient's PDF can have its own password.
+	UserPassword string `json:"userPassword"`
+	// OwnerPassword lifts the permissions; a random one is used if it's empty.
+	OwnerPassword string `json:"ownerPassword"`
+	// Deny lists the permissions readers who only know the user password don't have.
+	Deny []Permission `json:"deny"`
+}
+
+// IsZero reports whether the PDF shouldn't be encrypted.
+func (e Encryption) IsZero() bool {
+	return e.UserPassword == "" && e.OwnerPassword == "" && len(e.Deny) == 0
+}
+
+// Check returns an error if any of the denied permissions aren't known.
+func (e Encryption) Check() error {
+	for _, p := range e.Deny {
+		if !p.IsValid() {
+			return fmt.Errorf("invalid permission %q: must be one of print, modify, copy, annotate, fill-forms or assemble", p)
+		}
+	}
+	return nil
+}
+
+// permissions returns the user access permissions for the PDF's encryption dictionary.
+func (e Encryption) permissions() int16 {
+	// Start by granting everything, leaving the reserved bits alone
+	p := pdfcpu.PermissionsAll
+	for _, perm := range e.Deny {
+		for _, bit := range permissionBits[perm] {
+			p &^= 1 << (bit - 1)
+		}
+	}
+	return p
+}
+
+// encrypt encrypts the PDF at path in place with AES-256 according to the job's encryption options.
+func (j *Job) encrypt(ctx context.Context, path string) (err error) {
+	enc := j.Opts.Encryption
+	if enc.IsZero() {
+		return nil
+	}
+	_, span := tracing.Tracer().Start(ctx, "encrypt pdf")
+	defer func() {
+		if err != nil {
+			tracing.Fail(span, err)
+		}
+		span.End()
+	}()
+
+	userPW, err := j.fillField("user password", enc.UserPassword)
+	if err != nil {
+		countFailure(ctx, metrics.FailureTemplate)
+		return err
+	}
+	ownerPW := enc.OwnerPassword
+	if ownerPW == "" {
+		// Without an owner password, anyone who can open the PDF could lift the permissions
+		b := make([]byte, 32)
+		if _, err = rand.Read(b); err != nil {
+			countFailure(ctx, metrics.FailureIO)
+			return err
+		}
+		ownerPW = hex.EncodeToString(b)
+	}
+
+	conf := pdfcpu.NewAESConfiguration(userPW, ownerPW, 256)
+	conf.Permissions = enc.permissions()
+	if err = api.EncryptFile(path, "", conf); err != nil {
+		countFailure(ctx, metrics.FailureEncrypt)
+		return fmt.Errorf("error while encrypting pdf: %v", err)
+	}
+	return nil
+}
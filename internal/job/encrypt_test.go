@@ -0,0 +1,94 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+)
+
+// writeTestPDF writes a single, blank page PDF to path.
+func writeTestPDF(t *testing.T, path string) {
+	objs := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>",
+	}
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	// pdfcpu looks for the xref table in the last 512 bytes but expects there to be at least that many
+	buf.WriteString("%" + strings.Repeat("-", 512) + "\n")
+	offsets := make([]int, len(objs))
+	for i, obj := range objs {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, xref)
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJob_encrypt(t *testing.T) {
+	root, err := ioutil.TempDir("", "latte-job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	path := filepath.Join(root, "job.pdf")
+	writeTestPDF(t, path)
+
+	j := NewJob(root, nil)
+	j.Details = map[string]interface{}{"employee": map[string]interface{}{"pin": "1234"}}
+	j.Opts.Encryption = Encryption{UserPassword: "#!.employee.pin!#", Deny: []Permission{PM_Print, PM_Copy}}
+	if err = j.encrypt(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(userPW string) (*pdfcpu.Context, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		conf := pdfcpu.NewDefaultConfiguration()
+		conf.UserPW = userPW
+		return api.ReadContext(f, conf)
+	}
+	if _, err = read("wrong"); err == nil {
+		t.Error("expected the PDF not to open with the wrong password")
+	}
+	ctx, err := read("1234")
+	if err != nil {
+		t.Fatalf("expected the PDF to open with the user password: %v", err)
+	}
+	if ctx.E == nil {
+		t.Fatal("expected the PDF to be encrypted")
+	}
+	for bit, allowed := range map[uint]bool{3: false, 4: true, 5: false, 6: true, 12: false} {
+		if got := ctx.E.P&(1<<(bit-1)) != 0; got != allowed {
+			t.Errorf("expected permission bit %d to be %v, got %v", bit, allowed, got)
+		}
+	}
+}
+
+func TestEncryption_Check(t *testing.T) {
+	if err := (Encryption{Deny: []Permission{PM_Print, PM_Assemble}}).Check(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := (Encryption{Deny: []Permission{"screenshot"}}).Check(); err == nil {
+		t.Error("expected an error for an unknown permission")
+	}
+}
@@ -0,0 +1,117 @@
+package job
+
+import (
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Fields returns the paths of the details fields referenced by t, e.g. "Address.City".
+// Fields used while ranging over another field are given relative to it followed by "[]", e.g. "Items[].Price".
+func Fields(t *template.Template) []string {
+	fw := fieldWalker{seen: map[string]bool{}}
+	for _, tt := range t.Templates() {
+		if tt.Tree != nil {
+			fw.walk(tt.Tree.Root, "", true)
+		}
+	}
+
+	fields := make([]string, 0, len(fw.seen))
+	for f := range fw.seen {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+type fieldWalker struct {
+	seen map[string]bool
+}
+
+func (fw *fieldWalker) add(dot string, ident []string) {
+	path := strings.Join(ident, ".")
+	if dot != "" {
+		path = dot + "." + path
+	}
+	fw.seen[path] = true
+}
+
+// walk records the fields found under n; dot is the path of the field that "." refers to at n.
+// If known is false, "." refers to something other than a field and fields relative to it aren't recorded.
+func (fw *fieldWalker) walk(n parse.Node, dot string, known bool) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			fw.walk(c, dot, known)
+		}
+	case *parse.ActionNode:
+		fw.walk(n.Pipe, dot, known)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			fw.walk(c, dot, known)
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			fw.walk(a, dot, known)
+		}
+	case *parse.ChainNode:
+		fw.walk(n.Node, dot, known)
+	case *parse.FieldNode:
+		if known {
+			fw.add(dot, n.Ident)
+		}
+	case *parse.VariableNode:
+		// $ always refers to the details themselves
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			fw.add("", n.Ident[1:])
+		}
+	case *parse.IfNode:
+		fw.walk(n.Pipe, dot, known)
+		fw.walk(n.List, dot, known)
+		fw.walk(n.ElseList, dot, known)
+	case *parse.RangeNode:
+		fw.walk(n.Pipe, dot, known)
+		inner, ok := fw.pipeDot(n.Pipe, dot, known)
+		fw.walk(n.List, inner+"[]", ok)
+		fw.walk(n.ElseList, dot, known)
+	case *parse.WithNode:
+		fw.walk(n.Pipe, dot, known)
+		inner, ok := fw.pipeDot(n.Pipe, dot, known)
+		fw.walk(n.List, inner, ok)
+		fw.walk(n.ElseList, dot, known)
+	case *parse.TemplateNode:
+		fw.walk(n.Pipe, dot, known)
+	}
+}
+
+// pipeDot returns the path of the field that p evaluates to, if p is a single field or ".".
+func (fw *fieldWalker) pipeDot(p *parse.PipeNode, dot string, known bool) (string, bool) {
+	if p == nil || len(p.Cmds) != 1 || len(p.Cmds[0].Args) != 1 {
+		return "", false
+	}
+	switch a := p.Cmds[0].Args[0].(type) {
+	case *parse.DotNode:
+		return dot, known
+	case *parse.FieldNode:
+		if !known {
+			return "", false
+		}
+		path := strings.Join(a.Ident, ".")
+		if dot != "" {
+			path = dot + "." + path
+		}
+		return path, true
+	case *parse.VariableNode:
+		if a.Ident[0] == "$" {
+			return strings.Join(a.Ident[1:], "."), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,48 @@
+package job
+
+import (
+	"reflect"
+	"testing"
+	"text/template"
+)
+
+func TestFields(t *testing.T) {
+	tt := []struct {
+		Name     string
+		Template string
+		Expected []string
+	}{
+		{
+			Name:     "Plain fields",
+			Template: `\section{#!.Title!#} #!.Author.Name!# #!.Title!#`,
+			Expected: []string{"Author.Name", "Title"},
+		},
+		{
+			Name:     "Range",
+			Template: `#!range .Items!#\item #!.Name!# costs #!.Price!##!else!##!.Empty!##!end!#`,
+			Expected: []string{"Empty", "Items", "Items[].Name", "Items[].Price"},
+		},
+		{
+			Name:     "Nested with and root variable",
+			Template: `#!with .Address!##!.City!#, #!$.Country!##!end!#`,
+			Expected: []string{"Address", "Address.City", "Country"},
+		},
+		{
+			Name:     "Function arguments and conditions",
+			Template: `#!if and .Paid .Total!##!printf "%.2f" .Total!##!end!#`,
+			Expected: []string{"Paid", "Total"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			tmpl, err := template.New("test").Delims("#!", "!#").Parse(tc.Template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fields := Fields(tmpl); !reflect.DeepEqual(fields, tc.Expected) {
+				t.Errorf("expected fields %v, got %v", tc.Expected, fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package job
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Funcs are the functions available to templates on top of those built into text/template.
+var Funcs = template.FuncMap{
+	"texEscape": TexEscape,
+}
+
+var texEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`$`, `\$`,
+	`&`, `\&`,
+	`%`, `\%`,
+	`#`, `\#`,
+	`_`, `\_`,
+	`~`, `\textasciitilde{}`,
+	`^`, `\textasciicircum{}`,
+)
+
+// TexEscape formats v as fmt.Sprint would, escaping any characters that are special to TeX so that they're typeset as is.
+func TexEscape(v interface{}) string {
+	return texEscaper.Replace(fmt.Sprint(v))
+}
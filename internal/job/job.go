@@ -1,15 +1,21 @@
 package job
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"text/template"
 
 	"errors"
 
 	"github.com/raphaelreyna/go-recon"
+	"github.com/raphaelreyna/latte/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Job represents the request for constructing a tex file from the template and details and then compiling that into a PDF.
@@ -18,6 +24,12 @@ type Job struct {
 	Template *template.Template
 	Details  map[string]interface{}
 	Opts     Options
+
+	// TexFile is the path of the filled-in tex file once Compile has created it.
+	TexFile string
+	// Outputs are the names of the files in the working directory that Compile produced, in page order for paged
+	// output formats.
+	Outputs []string
 }
 
 func NewJob(root string, sc recon.SourceChain) *Job {
@@ -41,14 +53,72 @@ func (j *Job) AddResource(files ...string) {
 	}
 }
 
+// linkResources adds any of the Jobs resource files missing from the root directory by searching the SourceChain.
+// The returned error lists every resource that couldn't be added along with why each source couldn't provide it.
+func (j *Job) linkResources(ctx context.Context) error {
+	_, span := tracing.Tracer().Start(ctx, "Job.linkResources")
+	span.SetAttributes(attribute.Int("latte.resources", len(j.Files)))
+	defer span.End()
+
+	if err := j.checkJobNameClash(); err != nil {
+		tracing.Fail(span, err)
+		return err
+	}
+	if j.FilesPerm == 0 {
+		j.FilesPerm = 0644
+	}
+	// Reconcile hides this error, so check for it first
+	missing, err := j.MissingFiles()
+	if err != nil {
+		tracing.Fail(span, err)
+		return err
+	}
+
+	var problems []string
+	for _, f := range missing {
+		se, err := f.AddTo(j.Root, int(j.FilesPerm), j.SourceChain)
+		if err == nil {
+			continue
+		}
+		var reasons []string
+		for _, serr := range se {
+			reasons = append(reasons, serr.Error())
+		}
+		sort.Strings(reasons)
+		if len(reasons) == 0 {
+			reasons = append(reasons, err.Error())
+		}
+		problems = append(problems, fmt.Sprintf("%s (%s)", f.Name, strings.Join(reasons, "; ")))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	err = fmt.Errorf("could not add resources: %s", strings.Join(problems, ", "))
+	tracing.Fail(span, err)
+	return err
+}
+
 // GetTemplate looks for a template named id in the SourceChain and parses it, storing the results for later use.
-func (j *Job) GetTemplate(id string) error {
+func (j *Job) GetTemplate(ctx context.Context, id string) (err error) {
+	_, span := tracing.Tracer().Start(ctx, "Job.GetTemplate")
+	span.SetAttributes(attribute.String("latte.template", id))
+	defer func() {
+		if err != nil {
+			tracing.Fail(span, err)
+		}
+		span.End()
+	}()
+
+	if err = CheckName(id); err != nil {
+		return err
+	}
 	// Make sure the delimiters aren't empty
 	if j.Opts.Delims == BadDefaultDelimiters || j.Opts.Delims == EmptyDelimiters {
 		return errors.New("invalid delimiters, cannot parse template")
 	}
 	f := recon.File{Name: id}
-	_, err := f.AddTo(j.Root, 0644, j.SourceChain)
+	_, err = f.AddTo(j.Root, 0644, j.SourceChain)
 	if err != nil {
 		return err
 	}
@@ -61,7 +131,7 @@ func (j *Job) GetTemplate(id string) error {
 	}
 
 	t := template.New(id)
-	t = t.Delims(j.Opts.Delims.Left, j.Opts.Delims.Right)
+	t = t.Delims(j.Opts.Delims.Left, j.Opts.Delims.Right).Funcs(Funcs)
 	t, err = t.Parse(string(data))
 	if err != nil {
 		return err
@@ -72,9 +142,21 @@ func (j *Job) GetTemplate(id string) error {
 }
 
 // GetDetails looks for a details file named id in the SourceChain and stores the results for later.
-func (j *Job) GetDetails(id string) error {
+func (j *Job) GetDetails(ctx context.Context, id string) (err error) {
+	_, span := tracing.Tracer().Start(ctx, "Job.GetDetails")
+	span.SetAttributes(attribute.String("latte.details", id))
+	defer func() {
+		if err != nil {
+			tracing.Fail(span, err)
+		}
+		span.End()
+	}()
+
+	if err = CheckName(id); err != nil {
+		return err
+	}
 	f := recon.File{Name: id}
-	_, err := f.AddTo(j.Root, 0644, j.SourceChain)
+	_, err = f.AddTo(j.Root, 0644, j.SourceChain)
 	if err != nil {
 		return err
 	}
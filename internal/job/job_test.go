@@ -5,7 +5,10 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/raphaelreyna/go-recon/sources"
 )
 
 type Test struct {
@@ -49,11 +52,11 @@ func (t *Test) Run(tt *testing.T, root string) {
 		tt.Fatal(err)
 	}
 
-	if err = j.GetTemplate(t.Env.TexFile); err != nil {
+	if err = j.GetTemplate(context.Background(), t.Env.TexFile); err != nil {
 		tt.Fatal(err)
 	}
 
-	if err = j.GetDetails(t.Env.DtlsFile); err != nil {
+	if err = j.GetDetails(context.Background(), t.Env.DtlsFile); err != nil {
 		tt.Fatal(err)
 	}
 
@@ -106,13 +109,62 @@ func TestJob_Compile(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
+			// Clean up even when the test fails part way through
+			defer func() {
+				os.Chdir(currDir)
+				os.RemoveAll(testingDir)
+			}()
 			err = os.Chdir(testingDir)
 			if err != nil {
 				t.Fatal(err)
 			}
 			test.Run(tt, testingDir)
-			os.Chdir("../")
-			os.RemoveAll(testingDir)
 		})
 	}
 }
+
+func TestJob_linkResources(t *testing.T) {
+	rscDir, err := ioutil.TempDir("", "latte-rsc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rscDir)
+	if err = ioutil.WriteFile(filepath.Join(rscDir, "logo.png"), []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	root, err := ioutil.TempDir("", "latte-job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	j := NewJob(root, sources.NewDirSourceChain(sources.SoftLink, rscDir))
+	j.AddResource("logo.png")
+	if err = j.linkResources(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(root, "logo.png")); err != nil {
+		t.Errorf("expected resource to be linked into the working directory: %v", err)
+	}
+
+	// Each source's reason for not having a resource is reported along with it
+	j.AddResource("missing.png")
+	err = j.linkResources(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "could not add resources: missing.png (file does not exist)") {
+		t.Errorf("expected an error explaining why missing.png couldn't be added, got %v", err)
+	}
+
+	// Reproducible jobs would write their output through links to resources named after their jobname
+	if err = ioutil.WriteFile(filepath.Join(rscDir, "latte.pdf"), []byte("pdf"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	j = NewJob(root, sources.NewDirSourceChain(sources.SoftLink, rscDir))
+	j.Opts.Reproducible = true
+	j.AddResource("latte.pdf")
+	if err = j.linkResources(context.Background()); err == nil {
+		t.Error("expected an error for a resource named after the reproducible jobname")
+	}
+	if _, err = os.Lstat(filepath.Join(root, "latte.pdf")); !os.IsNotExist(err) {
+		t.Errorf("expected latte.pdf not to be linked into the working directory, got %v", err)
+	}
+}
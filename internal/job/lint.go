@@ -0,0 +1,367 @@
+package job
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Severity is how serious a LintIssue is.
+type Severity string
+
+var (
+	// SeverityError marks issues that will cause filling in or compiling the template to fail.
+	SeverityError Severity = "error"
+	// SeverityWarning marks issues that are likely, but not certain, to be mistakes.
+	SeverityWarning Severity = "warning"
+)
+
+// LintIssue is a problem found in a template by Lint.
+type LintIssue struct {
+	Severity Severity `json:"severity"`
+	// Line and Column locate the issue in the template, starting from 1; Column is 0 if it isn't known.
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func (li LintIssue) String() string {
+	if li.Column > 0 {
+		return fmt.Sprintf("%d:%d: %s: %s", li.Line, li.Column, li.Severity, li.Message)
+	}
+	return fmt.Sprintf("%d: %s: %s", li.Line, li.Severity, li.Message)
+}
+
+// maxUnknownFuncs caps how many times Lint reparses a template to find every unknown function it calls.
+const maxUnknownFuncs = 32
+
+var unknownFuncRe = regexp.MustCompile(`function "([^"]+)" not defined`)
+
+// texSpecials are the characters that mean something to TeX and so shouldn't be used in delimiters.
+var texSpecials = []struct {
+	char    string
+	meaning string
+}{
+	{`{`, "open a group"},
+	{`}`, "close a group"},
+	{`%`, "start a comment"},
+	{`\`, "start control sequences"},
+	{`$`, "switch into math mode"},
+	{`&`, "separate table columns"},
+}
+
+// Lint parses text as a template named name using the delimiters d and checks it for problems:
+// template syntax errors, calls to unknown functions, delimiters that collide with TeX syntax, field values that are
+// output without being escaped for TeX, and unbalanced braces or mismatched \begin and \end in the static parts.
+// The issues found are returned in the order they appear in the template.
+func Lint(name, text string, d Delimiters) []LintIssue {
+	l := linter{src: text}
+	if d.Left == "" || d.Right == "" {
+		l.add(SeverityError, 1, "delimiters must not be empty")
+		return l.issues
+	}
+	l.checkDelims(d)
+
+	// Stub out unknown functions so that the rest of the template can still be checked
+	funcs := template.FuncMap{}
+	for k, v := range Funcs {
+		funcs[k] = v
+	}
+	var t *template.Template
+	for i := 0; ; i++ {
+		var err error
+		t, err = template.New(name).Delims(d.Left, d.Right).Funcs(funcs).Parse(text)
+		if err == nil {
+			break
+		}
+		line, msg := parseErrorPosition(name, err)
+		m := unknownFuncRe.FindStringSubmatch(msg)
+		if m == nil || i == maxUnknownFuncs {
+			l.issues = append(l.issues, LintIssue{Severity: SeverityError, Line: line, Message: msg})
+			l.sort()
+			return l.issues
+		}
+		l.issues = append(l.issues, LintIssue{Severity: SeverityError, Line: line, Message: fmt.Sprintf("unknown function %q", m[1])})
+		funcs[m[1]] = func(...interface{}) interface{} { return nil }
+	}
+
+	for _, tt := range t.Templates() {
+		if tt.Tree == nil || tt.Tree.Root == nil {
+			continue
+		}
+		l.checkOutputs(tt.Tree.Root)
+		tc := texChecker{linter: &l}
+		tc.walk(tt.Tree.Root)
+		tc.finish()
+	}
+	l.sort()
+	return l.issues
+}
+
+// parseErrorPosition splits the line number out of an error returned while parsing the template named name.
+func parseErrorPosition(name string, err error) (int, string) {
+	msg := err.Error()
+	rest := strings.TrimPrefix(msg, "template: "+name+":")
+	if rest == msg {
+		return 0, msg
+	}
+	i := strings.Index(rest, ": ")
+	if i < 0 {
+		return 0, msg
+	}
+	line, perr := strconv.Atoi(rest[:i])
+	if perr != nil {
+		return 0, msg
+	}
+	return line, rest[i+2:]
+}
+
+type linter struct {
+	src    string
+	issues []LintIssue
+}
+
+// add records an issue found at the byte offset pos of the template.
+func (l *linter) add(sev Severity, pos int, format string, a ...interface{}) {
+	if pos > len(l.src) {
+		pos = len(l.src)
+	}
+	line := 1 + strings.Count(l.src[:pos], "\n")
+	col := pos - strings.LastIndex(l.src[:pos], "\n")
+	l.issues = append(l.issues, LintIssue{Severity: sev, Line: line, Column: col, Message: fmt.Sprintf(format, a...)})
+}
+
+func (l *linter) sort() {
+	sort.SliceStable(l.issues, func(i, j int) bool {
+		a, b := l.issues[i], l.issues[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+func (l *linter) checkDelims(d Delimiters) {
+	for _, delim := range []struct{ side, value string }{{"left", d.Left}, {"right", d.Right}} {
+		for _, ts := range texSpecials {
+			if strings.Contains(delim.value, ts.char) {
+				l.issues = append(l.issues, LintIssue{
+					Severity: SeverityWarning,
+					Line:     1,
+					Message: fmt.Sprintf("%s delimiter %q contains %q, which TeX uses to %s; consider the default delimiters %q and %q",
+						delim.side, delim.value, ts.char, ts.meaning, DefaultDelimiters.Left, DefaultDelimiters.Right),
+				})
+			}
+		}
+	}
+}
+
+// checkOutputs warns about actions under n that output a value without passing it through texEscape.
+func (l *linter) checkOutputs(n parse.Node) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			l.checkOutputs(c)
+		}
+	case *parse.ActionNode:
+		// Assignments don't output anything
+		if len(n.Pipe.Decl) > 0 || len(n.Pipe.Cmds) == 0 {
+			return
+		}
+		cmd := n.Pipe.Cmds[len(n.Pipe.Cmds)-1]
+		if len(cmd.Args) != 1 {
+			return
+		}
+		switch cmd.Args[0].(type) {
+		case *parse.FieldNode, *parse.VariableNode, *parse.ChainNode, *parse.DotNode:
+			l.add(SeverityWarning, int(n.Pos), "%s is output without escaping; pipe it through texEscape if it may contain characters special to TeX such as & or %%", cmd.Args[0])
+		}
+	case *parse.IfNode:
+		l.checkOutputs(n.List)
+		l.checkOutputs(n.ElseList)
+	case *parse.RangeNode:
+		l.checkOutputs(n.List)
+		l.checkOutputs(n.ElseList)
+	case *parse.WithNode:
+		l.checkOutputs(n.List)
+		l.checkOutputs(n.ElseList)
+	}
+}
+
+// verbatimEnvs are environments whose contents TeX doesn't interpret.
+var verbatimEnvs = map[string]bool{
+	"verbatim":   true,
+	"verbatim*":  true,
+	"Verbatim":   true,
+	"lstlisting": true,
+	"minted":     true,
+	"comment":    true,
+}
+
+// texGroup is a brace or environment that's been opened in the static parts of a template.
+type texGroup struct {
+	// env is the name of the environment, or empty for a brace
+	env string
+	pos int
+}
+
+func (g texGroup) String() string {
+	if g.env == "" {
+		return `"{"`
+	}
+	return `\begin{` + g.env + `}`
+}
+
+// texChecker follows the braces and environments opened and closed in the static parts of a template.
+type texChecker struct {
+	*linter
+	open []texGroup
+	// verbatim is the environment whose contents are being skipped, if any
+	verbatim string
+}
+
+func (tc *texChecker) walk(n parse.Node) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			tc.walk(c)
+		}
+	case *parse.TextNode:
+		tc.scan(string(n.Text), int(n.Pos))
+	case *parse.IfNode:
+		tc.branches(n.List, n.ElseList)
+	case *parse.RangeNode:
+		tc.branches(n.List, n.ElseList)
+	case *parse.WithNode:
+		tc.branches(n.List, n.ElseList)
+	}
+}
+
+// branches checks the alternatives of a conditional separately since only one of them will make it into the output,
+// carrying on from where the first one leaves off.
+func (tc *texChecker) branches(list, elseList *parse.ListNode) {
+	open := append([]texGroup(nil), tc.open...)
+	verbatim := tc.verbatim
+	tc.walk(list)
+	if elseList == nil {
+		return
+	}
+	afterOpen, afterVerbatim := tc.open, tc.verbatim
+	tc.open, tc.verbatim = open, verbatim
+	tc.walk(elseList)
+	tc.open, tc.verbatim = afterOpen, afterVerbatim
+}
+
+// scan checks text, which starts at the byte offset base of the template.
+func (tc *texChecker) scan(text string, base int) {
+	for i := 0; i < len(text); i++ {
+		if tc.verbatim != "" {
+			end := `\end{` + tc.verbatim + `}`
+			k := strings.Index(text[i:], end)
+			if k < 0 {
+				return
+			}
+			i += k + len(end) - 1
+			tc.open = tc.open[:len(tc.open)-1]
+			tc.verbatim = ""
+			continue
+		}
+
+		switch text[i] {
+		case '%':
+			k := strings.IndexByte(text[i:], '\n')
+			if k < 0 {
+				return
+			}
+			i += k
+		case '{':
+			tc.open = append(tc.open, texGroup{pos: base + i})
+		case '}':
+			tc.closeBrace(base + i)
+		case '\\':
+			j := i + 1
+			for j < len(text) && isLetter(text[j]) {
+				j++
+			}
+			if j == i+1 {
+				// A control symbol such as \{ or \%
+				i++
+				continue
+			}
+			word := text[i+1 : j]
+			if (word == "begin" || word == "end") && j < len(text) && text[j] == '{' {
+				if k := strings.IndexByte(text[j:], '}'); k > 1 {
+					env := text[j+1 : j+k]
+					if word == "begin" {
+						tc.open = append(tc.open, texGroup{env: env, pos: base + i})
+						if verbatimEnvs[env] {
+							tc.verbatim = env
+						}
+					} else {
+						tc.end(env, base+i)
+					}
+					i = j + k
+					continue
+				}
+			}
+			i = j - 1
+		}
+	}
+}
+
+func (tc *texChecker) closeBrace(pos int) {
+	if len(tc.open) == 0 {
+		tc.add(SeverityWarning, pos, `unmatched "}"`)
+		return
+	}
+	top := tc.open[len(tc.open)-1]
+	if top.env != "" {
+		tc.add(SeverityWarning, pos, `"}" closes a brace opened before %s on line %d`, top, tc.lineOf(top.pos))
+		return
+	}
+	tc.open = tc.open[:len(tc.open)-1]
+}
+
+func (tc *texChecker) end(env string, pos int) {
+	for i := len(tc.open) - 1; i >= 0; i-- {
+		if tc.open[i].env != env {
+			continue
+		}
+		for _, g := range tc.open[i+1:] {
+			tc.add(SeverityWarning, pos, `\end{%s} found while %s from line %d is still open`, env, g, tc.lineOf(g.pos))
+		}
+		tc.open = tc.open[:i]
+		return
+	}
+	tc.add(SeverityWarning, pos, `\end{%s} without a matching \begin{%s}`, env, env)
+}
+
+// finish reports anything left open at the end of the template.
+func (tc *texChecker) finish() {
+	for _, g := range tc.open {
+		if g.env == "" {
+			tc.add(SeverityWarning, g.pos, `"{" is never closed`)
+		} else {
+			tc.add(SeverityWarning, g.pos, `%s is never ended`, g)
+		}
+	}
+	tc.open = nil
+}
+
+func (tc *texChecker) lineOf(pos int) int {
+	return 1 + strings.Count(tc.src[:pos], "\n")
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
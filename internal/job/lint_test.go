@@ -0,0 +1,95 @@
+package job
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	tt := []struct {
+		Name     string
+		Template string
+		Delims   Delimiters
+		Expected []LintIssue
+	}{
+		{
+			Name: "Clean",
+			Template: `\documentclass{article}
+\begin{document}
+Hello #!.Name | texEscape!#
+#!if .Title!#\textbf{#!.Title | texEscape!#}#!else!#\emph{Untitled}#!end!#
+\begin{verbatim}
+{ \end{itemize}
+\end{verbatim}
+50\% off % not a brace: {
+\end{document}
+`,
+		},
+		{
+			Name:     "Syntax error",
+			Template: "Hello\n#!if .Name!#\n",
+			Expected: []LintIssue{
+				{Severity: SeverityError, Line: 3, Message: "unexpected EOF"},
+			},
+		},
+		{
+			Name:     "Unknown functions",
+			Template: "#!upper .Name | texEscape!#\n#!lower .Name | texEscape!#",
+			Expected: []LintIssue{
+				{Severity: SeverityError, Line: 1, Message: `unknown function "upper"`},
+				{Severity: SeverityError, Line: 2, Message: `unknown function "lower"`},
+			},
+		},
+		{
+			Name:     "Unescaped outputs",
+			Template: "#!$n := .Name!#Hi #!.Name!#, #!range .Items!##!.!##!end!#",
+			Expected: []LintIssue{
+				{Severity: SeverityWarning, Line: 1, Column: 21, Message: ".Name is output without escaping; pipe it through texEscape if it may contain characters special to TeX such as & or %"},
+				{Severity: SeverityWarning, Line: 1, Column: 48, Message: ". is output without escaping; pipe it through texEscape if it may contain characters special to TeX such as & or %"},
+			},
+		},
+		{
+			Name:     "Colliding delimiters",
+			Template: "Hi",
+			Delims:   BadDefaultDelimiters,
+			Expected: []LintIssue{
+				{Severity: SeverityWarning, Line: 1, Message: `left delimiter "{{" contains "{", which TeX uses to open a group; consider the default delimiters "#!" and "!#"`},
+				{Severity: SeverityWarning, Line: 1, Message: `right delimiter "}}" contains "}", which TeX uses to close a group; consider the default delimiters "#!" and "!#"`},
+			},
+		},
+		{
+			Name: "Unbalanced TeX",
+			Template: `\begin{document}
+\begin{itemize}
+\textbf{a
+\end{enumerate}
+}}
+\end{document}
+\section{`,
+			Expected: []LintIssue{
+				{Severity: SeverityWarning, Line: 4, Column: 1, Message: `\end{enumerate} without a matching \begin{enumerate}`},
+				{Severity: SeverityWarning, Line: 5, Column: 2, Message: `"}" closes a brace opened before \begin{itemize} on line 2`},
+				{Severity: SeverityWarning, Line: 6, Column: 1, Message: `\end{document} found while \begin{itemize} from line 2 is still open`},
+				{Severity: SeverityWarning, Line: 7, Column: 9, Message: `"{" is never closed`},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			d := tc.Delims
+			if d == EmptyDelimiters {
+				d = DefaultDelimiters
+			}
+			if issues := Lint("test.tex", tc.Template, d); !reflect.DeepEqual(issues, tc.Expected) {
+				t.Errorf("expected %+v, got %+v", tc.Expected, issues)
+			}
+		})
+	}
+}
+
+func TestTexEscape(t *testing.T) {
+	if s := TexEscape(`50% of $5 & {x}_1 \o/`); s != `50\% of \$5 \& \{x\}\_1 \textbackslash{}o/` {
+		t.Errorf("unexpected escaped string: %s", s)
+	}
+}
@@ -0,0 +1,145 @@
+package job
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Metadata is the document information written into the PDF's info dictionary and XMP metadata.
+type Metadata struct {
+	Title    string   `json:"title"`
+	Author   string   `json:"author"`
+	Subject  string   `json:"subject"`
+	Keywords []string `json:"keywords"`
+}
+
+// IsZero reports whether no metadata has been set.
+func (m Metadata) IsZero() bool {
+	return m.Title == "" && m.Author == "" && m.Subject == "" && len(m.Keywords) == 0
+}
+
+// fillMetadata returns the job's metadata with each field filled in with the details.
+func (j *Job) fillMetadata() (Metadata, error) {
+	md := j.Opts.Metadata
+	if md.IsZero() {
+		return md, nil
+	}
+
+	fill := func(field, text string) (string, error) {
+		text, err := j.fillField("metadata "+field, text)
+		return strings.TrimSpace(text), err
+	}
+
+	var filled Metadata
+	var err error
+	if filled.Title, err = fill("title", md.Title); err != nil {
+		return filled, err
+	}
+	if filled.Author, err = fill("author", md.Author); err != nil {
+		return filled, err
+	}
+	if filled.Subject, err = fill("subject", md.Subject); err != nil {
+		return filled, err
+	}
+	for _, kw := range md.Keywords {
+		if kw, err = fill("keywords", kw); err != nil {
+			return filled, err
+		}
+		if kw != "" {
+			filled.Keywords = append(filled.Keywords, kw)
+		}
+	}
+	return filled, nil
+}
+
+// addMetadata has hyperref and hyperxmp write md into the PDF's info dictionary and XMP metadata by setting it at
+// the end of the preamble of the filled-in tex, after whatever the template sets itself.
+func addMetadata(tex []byte, md Metadata) ([]byte, error) {
+	if md.IsZero() {
+		return tex, nil
+	}
+	i := bytes.Index(tex, []byte(`\begin{document}`))
+	if i < 0 {
+		return nil, errors.New("template has no \\begin{document} to set the metadata before")
+	}
+
+	var settings []string
+	for _, s := range []struct{ key, value string }{
+		{"pdftitle", md.Title},
+		{"pdfauthor", md.Author},
+		{"pdfsubject", md.Subject},
+		{"pdfkeywords", strings.Join(md.Keywords, ", ")},
+	} {
+		if s.value != "" {
+			settings = append(settings, fmt.Sprintf("%s={%s}", s.key, TexEscape(s.value)))
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Write(tex[:i])
+	buf.WriteString("\\makeatletter\\@ifpackageloaded{hyperref}{}{\\usepackage{hyperref}}\\makeatother\n")
+	buf.WriteString("\\usepackage{hyperxmp}\n")
+	fmt.Fprintf(&buf, "\\hypersetup{%s}\n", strings.Join(settings, ","))
+	buf.Write(tex[i:])
+	return buf.Bytes(), nil
+}
+
+// xmpEscaper escapes the characters that pdfx's .xmpdata files need written as macros.
+var xmpEscaper = strings.NewReplacer(
+	`\`, `\xmpbackslash{}`,
+	`{`, `\xmplbrace{}`,
+	`}`, `\xmprbrace{}`,
+	`%`, `\xmppercent{}`,
+	`#`, `\xmphash{}`,
+	`&`, `\xmpamp{}`,
+	`~`, `\xmptilde{}`,
+	`^`, `\xmpcaret{}`,
+	`$`, `\$`,
+	`_`, `\_`,
+)
+
+// xmpData returns the contents of the .xmpdata file that pdfx reads md from.
+func xmpData(md Metadata) string {
+	var sb strings.Builder
+	for _, f := range []struct{ name, value string }{
+		{"Title", md.Title},
+		{"Author", md.Author},
+		{"Subject", md.Subject},
+	} {
+		if f.value != "" {
+			fmt.Fprintf(&sb, "\\%s{%s}\n", f.name, xmpEscaper.Replace(f.value))
+		}
+	}
+	if len(md.Keywords) > 0 {
+		kws := make([]string, len(md.Keywords))
+		for i, kw := range md.Keywords {
+			kws[i] = xmpEscaper.Replace(kw)
+		}
+		// pdfx separates the entries of lists with \sep
+		fmt.Fprintf(&sb, "\\Keywords{%s}\n", strings.Join(kws, `\sep `))
+	}
+	return sb.String()
+}
+
+// fillField fills in text, the value of one of the jobs text options such as its metadata, watermark text, signature
+// reason or user password, with the details. Options may use the same template syntax, functions and delimiters as the
+// template itself. The field is only used to describe errors.
+func (j *Job) fillField(field, text string) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	d := j.Opts.Delims.OrDefault()
+	t, err := template.New(field).Delims(d.Left, d.Right).Funcs(Funcs).
+		Option("missingkey=" + j.Opts.OnMissingKey.Val()).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("error while parsing %s: %v", field, err)
+	}
+	var buf bytes.Buffer
+	if err = t.Execute(&buf, j.Details); err != nil {
+		return "", fmt.Errorf("error while filling in %s: %v", field, err)
+	}
+	return buf.String(), nil
+}
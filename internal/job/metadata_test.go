@@ -0,0 +1,79 @@
+package job
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJob_fillMetadata(t *testing.T) {
+	j := NewJob("", nil)
+	j.Details = map[string]interface{}{"number": 42, "customer": "Smith & Sons", "paid": false}
+	j.Opts.Metadata = Metadata{
+		Title:    "Invoice #!.number!#",
+		Author:   " ACME ",
+		Keywords: []string{"invoice", "#!.customer!#", "#!if .paid!#paid#!end!#"},
+	}
+	md, err := j.fillMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Metadata{Title: "Invoice 42", Author: "ACME", Keywords: []string{"invoice", "Smith & Sons"}}
+	if !reflect.DeepEqual(md, expected) {
+		t.Errorf("expected %+v, got %+v", expected, md)
+	}
+
+	j.Opts.Metadata = Metadata{Subject: "#!.missing!#"}
+	if _, err = j.fillMetadata(); err == nil || !strings.Contains(err.Error(), "metadata subject") {
+		t.Errorf("expected an error filling in the subject, got %v", err)
+	}
+}
+
+func TestAddMetadata(t *testing.T) {
+	tex := "\\documentclass{article}\n\\begin{document}\nHi\n\\end{document}\n"
+	out, err := addMetadata([]byte(tex), Metadata{Title: "50% off, today", Keywords: []string{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "\\documentclass{article}\n" +
+		"\\makeatletter\\@ifpackageloaded{hyperref}{}{\\usepackage{hyperref}}\\makeatother\n" +
+		"\\usepackage{hyperxmp}\n" +
+		"\\hypersetup{pdftitle={50\\% off, today},pdfkeywords={a, b}}\n" +
+		"\\begin{document}\nHi\n\\end{document}\n"
+	if string(out) != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+
+	if out, err = addMetadata([]byte(tex), Metadata{}); err != nil || string(out) != tex {
+		t.Errorf("expected tex to be left alone without metadata, got %q, %v", out, err)
+	}
+	if _, err = addMetadata([]byte("Hi"), Metadata{Title: "Hi"}); err == nil {
+		t.Error("expected an error for a template without \\begin{document}")
+	}
+}
+
+func TestJob_addConformance_Metadata(t *testing.T) {
+	root, err := ioutil.TempDir("", "latte-job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	j := NewJob(root, nil)
+	j.Opts.Conformance = CF_PDFA2b
+
+	md := Metadata{Title: "Q&A #1", Author: "Alice", Keywords: []string{"a", "{b}"}}
+	if _, err = j.addConformance([]byte("\\documentclass{article}\n\\title{Ignored}"), "job", md); err != nil {
+		t.Fatal(err)
+	}
+	xmp, err := ioutil.ReadFile(filepath.Join(root, "job.xmpdata"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "\\Title{Q\\xmpamp{}A \\xmphash{}1}\n\\Author{Alice}\n\\Keywords{a\\sep \\xmplbrace{}b\\xmprbrace{}}\n"
+	if string(xmp) != expected {
+		t.Errorf("expected xmpdata %q, got %q", expected, xmp)
+	}
+}
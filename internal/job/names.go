@@ -0,0 +1,72 @@
+package job
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxNameLength is the longest a registered ID or resource name may be, in bytes.
+const MaxNameLength = 255
+
+// InvalidNameError is returned when a registered ID or resource name isn't safe to use as a file name.
+type InvalidNameError struct {
+	Name   string
+	Reason string
+}
+
+func (e *InvalidNameError) Error() string {
+	return fmt.Sprintf("invalid name %q: %s", e.Name, e.Reason)
+}
+
+// CheckName returns an *InvalidNameError if name, the ID of a registered file or the name of a resource, isn't a plain
+// file name that's safe to create in the root or work directory.
+// Valid names are already in canonical form: they're a single path element that can't be read as a path to
+// somewhere else, a hidden file, a command line flag or a latexmk config file, on any OS.
+func CheckName(name string) error {
+	invalid := func(reason string) error {
+		return &InvalidNameError{Name: name, Reason: reason}
+	}
+	switch {
+	case name == "":
+		return invalid("must not be empty")
+	case len(name) > MaxNameLength:
+		return invalid(fmt.Sprintf("must not be longer than %d bytes", MaxNameLength))
+	case !utf8.ValidString(name):
+		return invalid("must be valid UTF-8")
+	case strings.ContainsAny(name, `/\:`):
+		return invalid(`must not contain "/", "\" or ":"`)
+	case strings.HasPrefix(name, "."):
+		return invalid(`must not start with "."`)
+	case strings.HasPrefix(name, "-"):
+		return invalid(`must not start with "-"`)
+	case strings.HasSuffix(name, ".") || strings.HasSuffix(name, " "):
+		return invalid(`must not end with "." or a space`)
+	case strings.EqualFold(name, "latexmkrc"):
+		return invalid("must not be latexmkrc, which latexmk would run")
+	}
+	for _, r := range name {
+		if r != ' ' && !unicode.IsPrint(r) {
+			return invalid("must only contain printable characters")
+		}
+	}
+	// Belt and braces; none of the names that make it this far should change when cleaned
+	if filepath.Clean(name) != name || filepath.Base(name) != name {
+		return invalid("must be a plain file name")
+	}
+	return nil
+}
+
+// JoinName joins the registered ID or resource name to dir, making sure the result is a file directly inside of dir.
+func JoinName(dir, name string) (string, error) {
+	if err := CheckName(name); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	if filepath.Dir(path) != filepath.Clean(dir) {
+		return "", &InvalidNameError{Name: name, Reason: "must be a plain file name"}
+	}
+	return path, nil
+}
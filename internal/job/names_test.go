@@ -0,0 +1,127 @@
+package job
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// maliciousNames are registered IDs and resource names that must never be accepted.
+var maliciousNames = []string{
+	"",
+	".",
+	"..",
+	"../x",
+	"../../etc/passwd",
+	"/etc/passwd",
+	"a/../../b",
+	"a/b",
+	`..\..\windows\win.ini`,
+	`a\b`,
+	"C:evil.tex",
+	"file.tex:stream",
+	".latexmkrc",
+	"latexmkrc",
+	"LATEXMKRC",
+	".git",
+	"-shell-escape",
+	"--output-directory=x",
+	"x.tex\x00.png",
+	"a\nb.tex",
+	"tab\there",
+	"‮txt.exe",
+	"trailing.",
+	"trailing ",
+	"\xff\xfe.tex",
+	strings.Repeat("a", MaxNameLength+1),
+}
+
+func TestCheckName(t *testing.T) {
+	for _, name := range maliciousNames {
+		if err := CheckName(name); err == nil {
+			t.Errorf("expected %q to be rejected", name)
+		} else if _, ok := err.(*InvalidNameError); !ok {
+			t.Errorf("expected an *InvalidNameError for %q, got %T", name, err)
+		}
+	}
+
+	for _, name := range []string{
+		"hello-world.tex",
+		"hello-world_alice.json",
+		"logo.png",
+		"Invoice 2020.tex",
+		"résumé.tex",
+		"a..b",
+		"%2e%2e%2fetc",
+		strings.Repeat("a", MaxNameLength),
+	} {
+		if err := CheckName(name); err != nil {
+			t.Errorf("expected %q to be accepted: %v", name, err)
+		}
+	}
+}
+
+func TestJoinName(t *testing.T) {
+	if path, err := JoinName("/srv/latte", "logo.png"); err != nil || path != "/srv/latte/logo.png" {
+		t.Errorf("expected /srv/latte/logo.png, got %q (%v)", path, err)
+	}
+	for _, name := range maliciousNames {
+		if path, err := JoinName("/srv/latte", name); err == nil {
+			t.Errorf("expected %q to be rejected, got %s", name, path)
+		}
+	}
+}
+
+func TestRequest_NewJob_MaliciousResources(t *testing.T) {
+	parent, err := ioutil.TempDir("", "latte-names")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(parent)
+	root := filepath.Join(parent, "root")
+	if err = os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cache, err := NewTemplateCache(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range maliciousNames {
+		r := Request{Resources: map[string]string{name: "cHduZWQ="}}
+		if _, err := r.NewJob(root, nil, cache); err == nil {
+			t.Errorf("expected resource named %q to be rejected", name)
+		}
+	}
+	// Nothing may have been written next to the root directory
+	infos, err := ioutil.ReadDir(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		t.Errorf("expected only the root directory in %s, found %d entries", parent, len(infos))
+	}
+}
+
+func TestJob_ParseQuery_MaliciousNames(t *testing.T) {
+	cache, err := NewTemplateCache(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"tmpl", "dtls", "rsc"} {
+		for _, name := range maliciousNames {
+			j := NewJob(os.TempDir(), nil)
+			q := url.Values{key: {name}}
+			if key != "tmpl" {
+				q.Set("tmpl", "hello-world.tex")
+			}
+			if err := j.ParseQuery(context.Background(), q, cache); err == nil {
+				t.Errorf("expected %s=%q to be rejected", key, name)
+			}
+		}
+	}
+}
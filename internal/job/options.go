@@ -24,6 +24,7 @@ func init() {
 	} else {
 		CC_Default = CC_Latexmk
 	}
+	DefaultOptions.CC = CC_Default
 }
 
 // MissingKeyOpt controls how missing keys are handled when filling in a template
@@ -53,6 +54,22 @@ func (mko MissingKeyOpt) Val() string {
 	}
 }
 
+// RenderMode controls what a job produces in place of a PDF when only the template should be filled in.
+type RenderMode string
+
+var (
+	// RM_Compile compiles the filled-in template into a PDF.
+	RM_Compile RenderMode = ""
+	// RM_Tex produces the filled-in tex file without compiling it.
+	RM_Tex RenderMode = "tex"
+	// RM_Zip produces a zip archive of the working directory, including the filled-in tex file, without compiling.
+	RM_Zip RenderMode = "zip"
+)
+
+func (rm RenderMode) IsValid() bool {
+	return rm == RM_Compile || rm == RM_Tex || rm == RM_Zip
+}
+
 // Delimiters holds the left and right delimiters for a template
 type Delimiters struct {
 	Left  string
@@ -74,6 +91,14 @@ var EmptyDelimiters Delimiters = Delimiters{
 	Right: "",
 }
 
+// OrDefault returns d, or DefaultDelimiters if d is empty or holds Go's default delimiters, which collide with TeX.
+func (d Delimiters) OrDefault() Delimiters {
+	if d == EmptyDelimiters || d == BadDefaultDelimiters {
+		return DefaultDelimiters
+	}
+	return d
+}
+
 // Options holds the user settable options for a compilation job
 type Options struct {
 	// CC is the LaTeX compiler to use
@@ -84,6 +109,32 @@ type Options struct {
 	OnMissingKey MissingKeyOpt
 	// Delims holds the left and right delimiters to use for the template
 	Delims Delimiters
+	// Render controls whether the filled-in template is produced instead of a PDF
+	Render RenderMode
+	// Output is the format to compile the template into
+	Output OutputFormat
+	// DPI is the resolution PNG pages are rendered at; zero uses dvipng's default
+	DPI uint
+	// Conformance is the PDF standard, such as PDF/A-2b, that the PDF is made to conform to
+	Conformance Conformance
+	// Metadata is written into the PDF's info dictionary and XMP metadata
+	Metadata Metadata
+	// Watermark is stamped across the pages of the PDF
+	Watermark Watermark
+	// Encryption controls whether the PDF is encrypted and what readers are allowed to do with it
+	Encryption Encryption
+	// Signature controls whether the PDF is digitally signed with the Signer's certificate
+	Signature Signature
+	// Reproducible makes compiling the same inputs give byte-identical output by fixing the dates and IDs written into it
+	Reproducible bool
+	// SourceDate is the time, in seconds since the Unix epoch, written into reproducible output in place of the current time
+	SourceDate int64
+	// Pages selects which pages of PNG, SVG or PostScript output are produced, e.g. 1-3,5; empty means all of them
+	Pages string
+	// Sandbox controls how the compiler is confined; it's set by whoever runs LaTTe and can't be set by requests
+	Sandbox Sandbox
+	// Signer holds the certificate PDFs are signed with; like Sandbox, it can't be set by requests
+	Signer *Signer
 }
 
 var DefaultOptions Options = Options{
@@ -0,0 +1,311 @@
+package job
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/raphaelreyna/latte/internal/metrics"
+	"github.com/raphaelreyna/latte/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// OutputFormat is the kind of file a job is compiled into.
+type OutputFormat string
+
+var (
+	// OF_PDF compiles the template into a PDF; an empty output format means the same.
+	OF_PDF OutputFormat = "pdf"
+	// OF_PNG produces a PNG image of each page, rendered by dvipng.
+	OF_PNG OutputFormat = "png"
+	// OF_SVG produces an SVG image of each page, rendered by dvisvgm.
+	OF_SVG OutputFormat = "svg"
+	// OF_DVI compiles the template into a DVI file.
+	OF_DVI OutputFormat = "dvi"
+	// OF_PS produces a PostScript file, converted by dvips.
+	OF_PS OutputFormat = "ps"
+)
+
+// MaxDPI is the highest resolution PNG pages may be rendered at.
+const MaxDPI = 2400
+
+func (of OutputFormat) IsValid() bool {
+	switch of {
+	case "", OF_PDF, OF_PNG, OF_SVG, OF_DVI, OF_PS:
+		return true
+	}
+	return false
+}
+
+// Ext returns the file extension, without the dot, of files in this format.
+func (of OutputFormat) Ext() string {
+	if of == "" {
+		return string(OF_PDF)
+	}
+	return string(of)
+}
+
+// Paged reports whether a separate file is produced for each page.
+func (of OutputFormat) Paged() bool {
+	return of == OF_PNG || of == OF_SVG
+}
+
+// ContentType returns the MIME type of files in this format.
+func (of OutputFormat) ContentType() string {
+	switch of {
+	case OF_PNG:
+		return "image/png"
+	case OF_SVG:
+		return "image/svg+xml"
+	case OF_DVI:
+		return "application/x-dvi"
+	case OF_PS:
+		return "application/postscript"
+	default:
+		return "application/pdf"
+	}
+}
+
+// viaDVI reports whether the template has to be compiled into a DVI file, rather than a PDF, to produce this format.
+func (of OutputFormat) viaDVI() bool {
+	return of == OF_PNG || of == OF_SVG || of == OF_DVI || of == OF_PS
+}
+
+// pagesPattern matches a comma separated list of page numbers and ranges of pages, e.g. 1-3,5
+var pagesPattern = regexp.MustCompile(`^[0-9]+(-[0-9]+)?(,[0-9]+(-[0-9]+)?)*$`)
+
+// CheckPages returns an error if pages isn't a comma separated list of page numbers and ranges of pages such as
+// 1-3,5, counting from 1.
+func CheckPages(pages string) error {
+	if !pagesPattern.MatchString(pages) {
+		return fmt.Errorf("invalid pages %q: must be a comma separated list of pages and ranges of pages, e.g. 1-3,5", pages)
+	}
+	for _, r := range strings.Split(pages, ",") {
+		bounds := strings.SplitN(r, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil || first < 1 {
+			return fmt.Errorf("invalid pages %q: pages are counted from 1", pages)
+		}
+		if len(bounds) == 2 {
+			if last, err := strconv.Atoi(bounds[1]); err != nil || last < first {
+				return fmt.Errorf("invalid pages %q: range %s ends before it starts", pages, r)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckOutput returns an error if the output options don't make sense together.
+func (o Options) CheckOutput() error {
+	if !o.Output.IsValid() {
+		return fmt.Errorf("invalid output format %q: must be one of pdf, png, svg, dvi or ps", o.Output)
+	}
+	if o.DPI > 0 && o.Output != OF_PNG {
+		return errors.New("dpi can only be set for png output")
+	}
+	if o.DPI > MaxDPI {
+		return fmt.Errorf("dpi must not be more than %d", MaxDPI)
+	}
+	if !o.Conformance.IsValid() {
+		return fmt.Errorf("invalid conformance %q: must be one of pdfa-2b, pdfx-1a or pdfx-4", o.Conformance)
+	}
+	if o.Conformance != CF_None && o.Output.Ext() != string(OF_PDF) {
+		return errors.New("conformance can only be set for pdf output")
+	}
+	if !o.Metadata.IsZero() && o.Output.Ext() != string(OF_PDF) {
+		return errors.New("metadata can only be set for pdf output")
+	}
+	if err := o.Watermark.Check(); err != nil {
+		return err
+	}
+	if !o.Watermark.IsZero() {
+		if o.Output.Ext() != string(OF_PDF) {
+			return errors.New("watermarks can only be used with pdf output")
+		}
+		if o.Conformance != CF_None {
+			return fmt.Errorf("watermarks can't be used with %s, as the font they're drawn in isn't embedded", o.Conformance)
+		}
+	}
+	if !o.Encryption.IsZero() {
+		if o.Output.Ext() != string(OF_PDF) {
+			return errors.New("encryption can only be used with pdf output")
+		}
+		if o.Conformance != CF_None {
+			return fmt.Errorf("encryption can't be used with %s, which doesn't allow it", o.Conformance)
+		}
+		if err := o.Encryption.Check(); err != nil {
+			return err
+		}
+	}
+	if err := o.Signature.Check(); err != nil {
+		return err
+	}
+	if !o.Signature.IsZero() {
+		if o.Output.Ext() != string(OF_PDF) {
+			return errors.New("signatures can only be used with pdf output")
+		}
+		if !o.Encryption.IsZero() {
+			return errors.New("signatures can't be used with encryption")
+		}
+		if o.Signature.Mode == SG_Visible && o.Conformance != CF_None {
+			return fmt.Errorf("visible signatures can't be used with %s, as the font they're drawn in isn't embedded", o.Conformance)
+		}
+	}
+	if o.SourceDate != 0 && !o.Reproducible {
+		return errors.New("a source date can only be set for reproducible output")
+	}
+	if o.SourceDate < 0 {
+		return errors.New("source date must not be before the Unix epoch")
+	}
+	if o.Reproducible && (!o.Watermark.IsZero() || !o.Encryption.IsZero() || !o.Signature.IsZero()) {
+		return errors.New("reproducible output can't be watermarked, encrypted or signed, as these write the current time and random IDs into the PDF")
+	}
+	if o.Pages != "" {
+		if o.Output != OF_PNG && o.Output != OF_SVG && o.Output != OF_PS {
+			return errors.New("pages can only be selected for png, svg or ps output")
+		}
+		if err := CheckPages(o.Pages); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// convert turns the DVI file produced by compiling the job named jn into the job's output format, storing the names of
+// the resulting files in Outputs.
+// On failure, the converters output is returned.
+func (j *Job) convert(ctx context.Context, jn string) (string, error) {
+	of := j.Opts.Output
+	if !of.viaDVI() {
+		j.Outputs = []string{jn + ".pdf"}
+		return "", nil
+	}
+	if of == OF_DVI {
+		j.Outputs = []string{jn + ".dvi"}
+		return "", nil
+	}
+
+	var tool string
+	var args []string
+	switch of {
+	case OF_PS:
+		// -R2 keeps \specials from running commands regardless of how the system's config.ps is set up
+		tool, args = "dvips", []string{"-q", "-R2", "-o", jn + ".ps"}
+		if j.Opts.Pages != "" {
+			args = append(args, "-pp", j.Opts.Pages)
+		}
+	case OF_PNG:
+		// Pages are numbered as they're written, not by their TeX page numbers
+		tool, args = "dvipng", []string{"-q", "-o", jn + "-%d.png"}
+		if j.Opts.DPI > 0 {
+			args = append(args, "-D", strconv.Itoa(int(j.Opts.DPI)))
+		}
+		if j.Opts.Pages != "" {
+			args = append(args, "-pp", j.Opts.Pages)
+		}
+	case OF_SVG:
+		// Glyphs are drawn as paths so that the images look the same in every browser
+		pages := j.Opts.Pages
+		if pages == "" {
+			pages = "1-"
+		}
+		tool, args = "dvisvgm", []string{"--no-fonts", "--page=" + pages, "--output=" + jn + "-%p.svg"}
+	}
+	args = append(args, jn+".dvi")
+
+	ctx, span := tracing.Tracer().Start(ctx, "convert output")
+	span.SetAttributes(attribute.String("latte.converter", tool))
+	defer span.End()
+	cmd, err := j.command(ctx, tool, args)
+	if err != nil {
+		tracing.Fail(span, err)
+		countFailure(ctx, metrics.FailureConvert)
+		return "", err
+	}
+	if result, err := cmd.CombinedOutput(); err != nil {
+		tracing.Fail(span, err)
+		countFailure(ctx, metrics.FailureConvert)
+		return string(result), err
+	}
+
+	if !of.Paged() {
+		j.Outputs = []string{jn + "." + of.Ext()}
+		return "", nil
+	}
+	if j.Outputs, err = findPages(j.Root, jn, of.Ext()); err != nil {
+		countFailure(ctx, metrics.FailureIO)
+		return "", err
+	}
+	if len(j.Outputs) == 0 {
+		countFailure(ctx, metrics.FailureConvert)
+		return "", errors.New("no pages were produced; check that the selected pages exist")
+	}
+	return "", nil
+}
+
+// findPages returns the names of the page images for the job named jn in dir, ordered by page.
+func findPages(dir, jn, ext string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, jn+"-*."+ext))
+	if err != nil {
+		return nil, err
+	}
+	var pages []string
+	for _, path := range paths {
+		if _, ok := pageNumber(filepath.Base(path)); ok {
+			pages = append(pages, filepath.Base(path))
+		}
+	}
+	sort.Slice(pages, func(a, b int) bool {
+		na, _ := pageNumber(pages[a])
+		nb, _ := pageNumber(pages[b])
+		return na < nb
+	})
+	return pages, nil
+}
+
+// pageNumber returns the page number at the end of the name of a page image, e.g. 3 for abc-3.png or abc-03.svg.
+func pageNumber(name string) (int, bool) {
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	i := strings.LastIndex(name, "-")
+	if i < 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(name[i+1:])
+	return n, err == nil
+}
+
+// PageName returns the name clients see for the i'th file in Outputs, e.g. page-1.png.
+func (j *Job) PageName(i int) string {
+	name := j.Outputs[i]
+	n, ok := pageNumber(name)
+	if !ok {
+		return name
+	}
+	return fmt.Sprintf("page-%d%s", n, filepath.Ext(name))
+}
+
+// WriteOutputsZip writes a zip archive of the files in Outputs to w, each named as PageName names it.
+func (j *Job) WriteOutputsZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	for i, name := range j.Outputs {
+		fpath := filepath.Join(j.Root, name)
+		info, err := os.Stat(fpath)
+		if err != nil {
+			zw.Close()
+			return err
+		}
+		if err = zipFile(zw, fpath, j.PageName(i), info); err != nil {
+			zw.Close()
+			return err
+		}
+	}
+	return zw.Close()
+}
@@ -0,0 +1,139 @@
+package job
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOptions_CheckOutput(t *testing.T) {
+	tt := []struct {
+		Name     string
+		Opts     Options
+		Expected string
+	}{
+		{Name: "Default", Opts: Options{}},
+		{Name: "PDF", Opts: Options{Output: OF_PDF}},
+		{Name: "PNG", Opts: Options{Output: OF_PNG, DPI: 300, Pages: "1-3,5"}},
+		{Name: "SVG pages", Opts: Options{Output: OF_SVG, Pages: "2"}},
+		{Name: "PS pages", Opts: Options{Output: OF_PS, Pages: "1,3"}},
+		{Name: "PDF/A", Opts: Options{Conformance: CF_PDFA2b}},
+		{Name: "Invalid conformance", Opts: Options{Conformance: "pdfa-1b"}, Expected: "invalid conformance"},
+		{Name: "Conformance for PNG", Opts: Options{Output: OF_PNG, Conformance: CF_PDFX4}, Expected: "conformance can only be set for pdf output"},
+		{Name: "Encryption", Opts: Options{Encryption: Encryption{UserPassword: "pw", Deny: []Permission{PM_Print}}}},
+		{Name: "Encryption for PNG", Opts: Options{Output: OF_PNG, Encryption: Encryption{UserPassword: "pw"}}, Expected: "encryption can only be used with pdf output"},
+		{Name: "Encrypted PDF/A", Opts: Options{Conformance: CF_PDFA2b, Encryption: Encryption{UserPassword: "pw"}}, Expected: "encryption can't be used with PDF/A-2b"},
+		{Name: "Invalid permission", Opts: Options{Encryption: Encryption{Deny: []Permission{"fly"}}}, Expected: "invalid permission"},
+		{Name: "Watermark", Opts: Options{Watermark: Watermark{Text: "DRAFT"}}},
+		{Name: "Watermark for SVG", Opts: Options{Output: OF_SVG, Watermark: Watermark{Text: "DRAFT"}}, Expected: "watermarks can only be used with pdf output"},
+		{Name: "Watermarked PDF/X", Opts: Options{Conformance: CF_PDFX4, Watermark: Watermark{Text: "DRAFT"}}, Expected: "watermarks can't be used with PDF/X-4"},
+		{Name: "Signature", Opts: Options{Conformance: CF_PDFA2b, Signature: Signature{Mode: SG_Invisible}}},
+		{Name: "Signature for DVI", Opts: Options{Output: OF_DVI, Signature: Signature{Mode: SG_Invisible}}, Expected: "signatures can only be used with pdf output"},
+		{Name: "Signed and encrypted", Opts: Options{Encryption: Encryption{UserPassword: "pw"}, Signature: Signature{Mode: SG_Invisible}}, Expected: "signatures can't be used with encryption"},
+		{Name: "Visible signature on PDF/A", Opts: Options{Conformance: CF_PDFA2b, Signature: Signature{Mode: SG_Visible}}, Expected: "visible signatures can't be used with PDF/A-2b"},
+		{Name: "Reproducible", Opts: Options{Output: OF_PS, Reproducible: true, SourceDate: 1600000000}},
+		{Name: "Source date without reproducible", Opts: Options{SourceDate: 1600000000}, Expected: "a source date can only be set for reproducible output"},
+		{Name: "Negative source date", Opts: Options{Reproducible: true, SourceDate: -1}, Expected: "source date must not be before the Unix epoch"},
+		{Name: "Reproducible and signed", Opts: Options{Reproducible: true, Signature: Signature{Mode: SG_Invisible}}, Expected: "reproducible output can't be watermarked, encrypted or signed"},
+		{Name: "Invalid format", Opts: Options{Output: "docx"}, Expected: "invalid output format"},
+		{Name: "DPI for SVG", Opts: Options{Output: OF_SVG, DPI: 300}, Expected: "dpi can only be set for png output"},
+		{Name: "DPI too high", Opts: Options{Output: OF_PNG, DPI: MaxDPI + 1}, Expected: "dpi must not be more than"},
+		{Name: "Pages for PDF", Opts: Options{Pages: "1"}, Expected: "pages can only be selected"},
+		{Name: "Pages for DVI", Opts: Options{Output: OF_DVI, Pages: "1"}, Expected: "pages can only be selected"},
+		{Name: "Page zero", Opts: Options{Output: OF_PNG, Pages: "0-2"}, Expected: "pages are counted from 1"},
+		{Name: "Backwards range", Opts: Options{Output: OF_PNG, Pages: "3-1"}, Expected: "ends before it starts"},
+		{Name: "Malformed pages", Opts: Options{Output: OF_PNG, Pages: "1;rm -rf"}, Expected: "must be a comma separated list"},
+		{Name: "Flag as pages", Opts: Options{Output: OF_PS, Pages: "-o/etc/passwd"}, Expected: "must be a comma separated list"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := tc.Opts.CheckOutput()
+			if tc.Expected == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.Expected) {
+				t.Fatalf("expected error containing %q, got %v", tc.Expected, err)
+			}
+		})
+	}
+}
+
+func TestJob_convert(t *testing.T) {
+	// Stand in for dvipng with a script that records its arguments and writes pages out of order
+	bin, err := ioutil.TempDir("", "latte-bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bin)
+	script := "#!/bin/sh\necho \"$@\" > args\nfor n in 10 2 1; do echo $n > job-$n.png; done\n"
+	if err = ioutil.WriteFile(filepath.Join(bin, "dvipng"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	root, err := ioutil.TempDir("", "latte-job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// The converter is run in the job's directory, wherever the process is
+	j := NewJob(root, nil)
+	j.Opts.Output, j.Opts.DPI, j.Opts.Pages = OF_PNG, 150, "1-2,10"
+	if result, err := j.convert(context.Background(), "job"); err != nil {
+		t.Fatalf("unexpected error: %v: %s", err, result)
+	}
+
+	args, err := ioutil.ReadFile(filepath.Join(root, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.TrimSpace(string(args)); s != "-q -o job-%d.png -D 150 -pp 1-2,10 job.dvi" {
+		t.Errorf("unexpected dvipng arguments: %s", s)
+	}
+	if expected := []string{"job-1.png", "job-2.png", "job-10.png"}; !reflect.DeepEqual(j.Outputs, expected) {
+		t.Fatalf("expected outputs %v, got %v", expected, j.Outputs)
+	}
+
+	var buf bytes.Buffer
+	if err = j.WriteOutputsZip(&buf); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if expected := []string{"page-1.png", "page-2.png", "page-10.png"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected zip to contain %v, got %v", expected, names)
+	}
+
+	// dvips has to be kept from running commands
+	script = "#!/bin/sh\necho \"$@\" > args\n"
+	if err = ioutil.WriteFile(filepath.Join(bin, "dvips"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	j.Opts.Output, j.Opts.Pages = OF_PS, ""
+	if result, err := j.convert(context.Background(), "job"); err != nil {
+		t.Fatalf("unexpected error: %v: %s", err, result)
+	}
+	if args, err = ioutil.ReadFile(filepath.Join(root, "args")); err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.TrimSpace(string(args)); s != "-q -R2 -o job.ps job.dvi" {
+		t.Errorf("unexpected dvips arguments: %s", s)
+	}
+}
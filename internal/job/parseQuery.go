@@ -1,16 +1,37 @@
 package job
 
 import (
-	"net/url"
+	"context"
 	"errors"
-	"text/template"
+	"net/url"
 	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/raphaelreyna/latte/internal/tracing"
 )
 
 // ParseQuery takes url.Values and loads the template and resources referenced in q into the root directory.
-func (j *Job) ParseQuery(q url.Values, cache *TemplateCache) error {
+func (j *Job) ParseQuery(ctx context.Context, q url.Values, cache *TemplateCache) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Job.ParseQuery")
+	defer func() {
+		if err != nil {
+			tracing.Fail(span, err)
+		}
+		span.End()
+	}()
+
 	cOpts := j.Opts
 
+	// Everything referenced in the query ends up as a file in the root directory
+	for _, key := range []string{"tmpl", "dtls", "rsc"} {
+		for _, name := range q[key] {
+			if err := CheckName(name); err != nil {
+				return err
+			}
+		}
+	}
+
 	// Check if a registered template is being requested in the URL, if so make sure its available on the local disk
 	if tmplID := q.Get("tmpl"); j.Template == nil && tmplID != "" {
 		tmplID = tmplID + cOpts.Delims.Left + cOpts.Delims.Right
@@ -19,7 +40,7 @@ func (j *Job) ParseQuery(q url.Values, cache *TemplateCache) error {
 		ti, exists := cache.Get(tmplID)
 		if !exists {
 			// Look for the requested template in the source chain and parse it
-			if err := j.GetTemplate(q.Get("tmpl")); err != nil {
+			if err := j.GetTemplate(ctx, q.Get("tmpl")); err != nil {
 				cache.Unlock()
 				return err
 			}
@@ -46,7 +67,7 @@ func (j *Job) ParseQuery(q url.Values, cache *TemplateCache) error {
 
 	// Load and parse details json from local disk, downloading it from the db if not found on local disk
 	if dtID := q.Get("dtls"); len(j.Details) == 0 && dtID != "" {
-		if err := j.GetDetails(dtID); err != nil {
+		if err := j.GetDetails(ctx, dtID); err != nil {
 			return err
 		}
 	}
@@ -60,6 +81,71 @@ func (j *Job) ParseQuery(q url.Values, cache *TemplateCache) error {
 			cOpts.N = uint(n)
 		}
 	}
+	if cOpts.Render == "" {
+		cOpts.Render = RenderMode(q.Get("render"))
+		if !cOpts.Render.IsValid() {
+			return errors.New("invalid render query parameter")
+		}
+	}
+	if cOpts.Output == "" {
+		cOpts.Output = OutputFormat(q.Get("output"))
+		if !cOpts.Output.IsValid() {
+			return errors.New("invalid output query parameter")
+		}
+	}
+	if dpi := q.Get("dpi"); dpi != "" && cOpts.DPI == 0 {
+		n, err := strconv.ParseUint(dpi, 10, 0)
+		if err != nil {
+			return errors.New("invalid dpi query parameter")
+		}
+		cOpts.DPI = uint(n)
+	}
+	if cOpts.Pages == "" {
+		cOpts.Pages = q.Get("pages")
+	}
+	if cOpts.Conformance == "" {
+		cOpts.Conformance = Conformance(q.Get("conformance"))
+		if !cOpts.Conformance.IsValid() {
+			return errors.New("invalid conformance query parameter")
+		}
+	}
+	if cOpts.Metadata.IsZero() {
+		cOpts.Metadata = Metadata{Title: q.Get("title"), Author: q.Get("author"), Subject: q.Get("subject")}
+		if kws := q.Get("keywords"); kws != "" {
+			cOpts.Metadata.Keywords = strings.Split(kws, ",")
+		}
+	}
+	if cOpts.Watermark.IsZero() {
+		cOpts.Watermark.Text = q.Get("watermark")
+	}
+	if cOpts.Signature.IsZero() {
+		cOpts.Signature.Mode = SignatureMode(q.Get("signature"))
+		if !cOpts.Signature.Mode.IsValid() {
+			return errors.New("invalid signature query parameter")
+		}
+	}
+	if r := q.Get("reproducible"); r != "" && !cOpts.Reproducible {
+		b, err := strconv.ParseBool(r)
+		if err != nil {
+			return errors.New("invalid reproducible query parameter")
+		}
+		cOpts.Reproducible = b
+	}
+	if sd := q.Get("sourceDate"); sd != "" && cOpts.SourceDate == 0 {
+		n, err := strconv.ParseInt(sd, 10, 64)
+		if err != nil {
+			return errors.New("invalid sourceDate query parameter")
+		}
+		cOpts.SourceDate = n
+	}
+	if cOpts.Render == RM_Compile {
+		if err := cOpts.CheckOutput(); err != nil {
+			return err
+		}
+		if !cOpts.Signature.IsZero() && cOpts.Signer == nil {
+			return errors.New("no signing certificate has been configured")
+		}
+	}
 
 	// Set the job options
 	j.Opts = cOpts
@@ -0,0 +1,58 @@
+package job
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// reproducibleJobName is the jobname reproducible jobs are compiled under, in place of the name of their randomly
+// named working directory, since packages such as pdfx derive the IDs they write into the PDF from it.
+const reproducibleJobName = "latte"
+
+// jobName returns the name the job's tex file is compiled under, which is what its output files are named after.
+func (j *Job) jobName() string {
+	if j.Opts.Reproducible {
+		return reproducibleJobName
+	}
+	return filepath.Base(j.Root)
+}
+
+// checkJobNameClash returns an error if the job is reproducible and one of its resources is named like the files TeX
+// writes for it, since resources are linked into the working directory and those files would be written through the
+// link over the resource itself.
+func (j *Job) checkJobNameClash() error {
+	if !j.Opts.Reproducible {
+		return nil
+	}
+	for _, f := range j.Files {
+		if strings.HasPrefix(f.Name, reproducibleJobName+".") {
+			return fmt.Errorf("resource %q can't be used in a reproducible job, whose output files are named %s.*",
+				f.Name, reproducibleJobName)
+		}
+	}
+	return nil
+}
+
+// sourceDateEnv returns the environment variables that make TeX and the converters write the options source date,
+// instead of the current time, into their output when it should be reproducible.
+func (o Options) sourceDateEnv() []string {
+	if !o.Reproducible {
+		return nil
+	}
+	return []string{
+		"SOURCE_DATE_EPOCH=" + strconv.FormatInt(o.SourceDate, 10),
+		"FORCE_SOURCE_DATE=1",
+	}
+}
+
+// addTrailerID fixes the ID pdfTeX writes into the PDF's trailer, which is otherwise derived from the current time
+// and output path, to one derived from the filled-in tex so that the same tex always gets the same ID.
+func addTrailerID(tex []byte) []byte {
+	sum := sha256.Sum256(tex)
+	id := "\\ifdefined\\pdftrailerid\\pdftrailerid{" + hex.EncodeToString(sum[:]) + "}\\fi\n"
+	return append([]byte(id), tex...)
+}
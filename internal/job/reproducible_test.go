@@ -0,0 +1,111 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestJob_Fill_Reproducible(t *testing.T) {
+	fill := func() string {
+		root, err := ioutil.TempDir("", "latte-job")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(root)
+		j := NewJob(root, nil)
+		j.Opts.Reproducible = true
+		j.Template = template.Must(template.New("").Delims("#!", "!#").Parse(`Hello #!.name!#`))
+		j.Details = map[string]interface{}{"name": "Alice"}
+		if err = j.Fill(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if jn := j.jobName(); jn != reproducibleJobName {
+			t.Errorf("expected reproducible job to be named %q, got %q", reproducibleJobName, jn)
+		}
+		tex, err := ioutil.ReadFile(j.TexFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(tex)
+	}
+
+	tex := fill()
+	if !strings.HasPrefix(tex, "\\ifdefined\\pdftrailerid\\pdftrailerid{") || !strings.HasSuffix(tex, "}\\fi\nHello Alice") {
+		t.Errorf("expected a trailer ID before the filled-in template, got %q", tex)
+	}
+	if again := fill(); again != tex {
+		t.Errorf("expected the same trailer ID for the same tex, got %q and %q", tex, again)
+	}
+}
+
+func TestJob_command_Reproducible(t *testing.T) {
+	root, err := ioutil.TempDir("", "latte-job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	j := NewJob(root, nil)
+	if jn := j.jobName(); jn != filepath.Base(root) {
+		t.Errorf("expected job to be named after its directory, got %q", jn)
+	}
+
+	cmd, err := j.command(context.Background(), "pdflatex", []string{"a.tex"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env := strings.Join(cmd.Env, "\n"); strings.Contains(env, "FORCE_SOURCE_DATE=1") {
+		t.Error("expected FORCE_SOURCE_DATE to only be set for reproducible jobs")
+	}
+
+	j.Opts.Reproducible, j.Opts.SourceDate = true, 1600000000
+	if cmd, err = j.command(context.Background(), "pdflatex", []string{"a.tex"}); err != nil {
+		t.Fatal(err)
+	}
+	// The last value wins, so these must come after any inherited from LaTTe's own environment
+	env := cmd.Env[len(cmd.Env)-2:]
+	if env[0] != "SOURCE_DATE_EPOCH=1600000000" || env[1] != "FORCE_SOURCE_DATE=1" {
+		t.Errorf("expected the source date to be set in the compilers environment, got %v", env)
+	}
+}
+
+func TestJob_Compile_Reproducible(t *testing.T) {
+	if _, err := exec.LookPath("pdflatex"); err != nil {
+		t.Skip("pdflatex binary not found in $PATH")
+	}
+
+	// Each compile gets its own randomly named directory, as it would on the server
+	compile := func() []byte {
+		root, err := ioutil.TempDir("", "latte-job")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(root)
+		j := NewJob(root, nil)
+		j.Opts.CC = CC_PDFLatex
+		j.Opts.Reproducible, j.Opts.SourceDate = true, 1600000000
+		j.Template = template.Must(template.New("").Delims("#!", "!#").Parse(
+			"\\documentclass{article}\\begin{document}Hello #!.name!#\\end{document}",
+		))
+		j.Details = map[string]interface{}{"name": "Alice"}
+		pdf, err := j.Compile(context.Background())
+		if err != nil {
+			t.Fatalf("error while compiling: %v: %s", err, pdf)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(root, pdf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	if first, second := compile(), compile(); !bytes.Equal(first, second) {
+		t.Error("expected compiling the same job twice to produce byte-identical PDFs")
+	}
+}
@@ -6,22 +6,33 @@ import (
 	"encoding/hex"
 	"crypto/md5"
 	"encoding/base64"
-	"path/filepath"
 	"io/ioutil"
 	"os"
+	"errors"
 )
 
 type Request struct {
 	Template string `json:"template"`
 
-	Details map[string]interface{} `json:"details"`
+	Details Details `json:"details"`
 
-	Resources map[string]string `json:"resources"`
+	Resources Resources `json:"resources"`
 
 	Delimiters Delimiters `json:"delimiters"`
 	OnMissingKey MissingKeyOpt `json:"onMissingKey"`
 	Compiler Compiler `json:"compiler"`
 	Count uint `json:"count"`
+	Render RenderMode `json:"render"`
+	Output OutputFormat `json:"output"`
+	DPI uint `json:"dpi"`
+	Pages string `json:"pages"`
+	Conformance Conformance `json:"conformance"`
+	Metadata Metadata `json:"metadata"`
+	Encryption Encryption `json:"encryption"`
+	Watermark Watermark `json:"watermark"`
+	Signature Signature `json:"signature"`
+	Reproducible bool `json:"reproducible"`
+	SourceDate int64 `json:"sourceDate"`
 }
 
 func (r *Request) NewJob(root string, sc recon.SourceChain, cache *TemplateCache) (*Job, error) {
@@ -32,12 +43,8 @@ func (r *Request) NewJob(root string, sc recon.SourceChain, cache *TemplateCache
 
 	opts := DefaultOptions
 
-	if r.Delimiters != EmptyDelimiters && r.Delimiters != BadDefaultDelimiters {
-		opts.Delims = r.Delimiters
-	} else {
-		opts.Delims = DefaultDelimiters
-		r.Delimiters = DefaultDelimiters
-	}
+	r.Delimiters = r.Delimiters.OrDefault()
+	opts.Delims = r.Delimiters
 
 	if x := r.OnMissingKey; x != "" {
 		opts.OnMissingKey = x
@@ -48,6 +55,51 @@ func (r *Request) NewJob(root string, sc recon.SourceChain, cache *TemplateCache
 	if x := r.Count; x > 0 {
 		opts.N = x
 	}
+	if x := r.Render; x != "" {
+		if !x.IsValid() {
+			return nil, errors.New("invalid render field found in JSON body")
+		}
+		opts.Render = x
+	}
+	if x := r.Output; x != "" {
+		if !x.IsValid() {
+			return nil, errors.New("invalid output field found in JSON body")
+		}
+		opts.Output = x
+	}
+	if x := r.DPI; x > 0 {
+		opts.DPI = x
+	}
+	if x := r.Pages; x != "" {
+		opts.Pages = x
+	}
+	if x := r.Conformance; x != "" {
+		if !x.IsValid() {
+			return nil, errors.New("invalid conformance field found in JSON body")
+		}
+		opts.Conformance = x
+	}
+	if x := r.Metadata; !x.IsZero() {
+		opts.Metadata = x
+	}
+	if x := r.Encryption; !x.IsZero() {
+		opts.Encryption = x
+	}
+	if x := r.Watermark; x != (Watermark{}) {
+		opts.Watermark = x
+	}
+	if x := r.Signature; x != (Signature{}) {
+		if !x.Mode.IsValid() {
+			return nil, errors.New("invalid signature field found in JSON body")
+		}
+		opts.Signature = x
+	}
+	if r.Reproducible {
+		opts.Reproducible = true
+	}
+	if x := r.SourceDate; x != 0 {
+		opts.SourceDate = x
+	}
 
 	j.Opts = opts
 	j.Details = r.Details
@@ -59,7 +111,10 @@ func (r *Request) NewJob(root string, sc recon.SourceChain, cache *TemplateCache
 
 	// Write resources files into working directory
 	for name, data := range r.Resources {
-		fname := filepath.Join(root, name)
+		fname, err := JoinName(root, name)
+		if err != nil {
+			return nil, err
+		}
 		bytes, err := base64.StdEncoding.DecodeString(data)
 		if err != nil {
 			return nil, err
@@ -93,7 +148,7 @@ func (r *Request) parseTemplate(cache *TemplateCache) (*template.Template, error
 			cache.Unlock()
 			return nil, err
 		}
-		t = template.New(cid).Delims(r.Delimiters.Left, r.Delimiters.Right)
+		t = template.New(cid).Delims(r.Delimiters.Left, r.Delimiters.Right).Funcs(Funcs)
 		t, err = t.Parse(string(tBytes))
 		if err != nil {
 			cache.Unlock()
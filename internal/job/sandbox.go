@@ -0,0 +1,131 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Sandbox controls how the compiler is confined while it runs.
+type Sandbox string
+
+var (
+	// SB_None runs the compiler directly, relying on TeX's own restrictions.
+	SB_None Sandbox = ""
+	// SB_Bwrap runs the compiler under bubblewrap in fresh namespaces with no network access, where the only writable
+	// directory is the job's and only the system directories TeX needs are visible.
+	SB_Bwrap Sandbox = "bwrap"
+)
+
+func (sb Sandbox) IsValid() bool {
+	return sb == SB_None || sb == SB_Bwrap
+}
+
+// Available returns an error if the sandbox can't be used on this system.
+func (sb Sandbox) Available() error {
+	if sb != SB_Bwrap {
+		return nil
+	}
+	if runtime.GOOS != "linux" {
+		return errors.New("the bwrap sandbox is only available on Linux")
+	}
+	if _, err := exec.LookPath("bwrap"); err != nil {
+		return errors.New("the bwrap sandbox requires bubblewrap to be installed; bwrap binary not found in your $PATH")
+	}
+	return nil
+}
+
+// texEnv are the environment variables that keep TeX from reading or writing files outside of the job's directory,
+// or running shell commands, regardless of how the system's texmf.cnf is configured.
+var texEnv = []string{
+	"openin_any=p",
+	"openout_any=p",
+	"shell_escape=f",
+}
+
+// sandboxSystemDirs are mounted read-only inside the bwrap sandbox if they exist so that TeX and its libraries,
+// fonts and configuration can be found.
+var sandboxSystemDirs = []string{
+	"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/opt",
+	"/etc/texmf", "/etc/fonts", "/etc/alternatives", "/etc/ld.so.cache",
+	// TEXMFSYSVAR on Debian and Ubuntu, where the format files and ls-R databases are generated into
+	"/var/lib/texmf",
+}
+
+// command creates the command that runs compiler with args for the job, confined according to the job's sandbox.
+// It's run in the job's directory, which relative paths in args are resolved against.
+func (j *Job) command(ctx context.Context, compiler string, args []string) (*exec.Cmd, error) {
+	env := append(os.Environ(), texEnv...)
+	env = append(env, j.Opts.sourceDateEnv()...)
+	if j.Opts.Sandbox != SB_Bwrap {
+		cmd := exec.CommandContext(ctx, compiler, args...)
+		cmd.Dir = j.Root
+		cmd.Env = env
+		return cmd, nil
+	}
+
+	bargs := []string{
+		"--unshare-all", "--die-with-parent", "--new-session",
+		"--proc", "/proc", "--dev", "/dev", "--tmpfs", "/tmp",
+	}
+	for _, dir := range sandboxSystemDirs {
+		if _, err := os.Lstat(dir); err == nil {
+			bargs = append(bargs, "--ro-bind", dir, dir)
+		}
+	}
+	// TeX installations outside of the system directories, such as those from the TeX Live installer
+	if path, err := exec.LookPath(compiler); err == nil {
+		if path, err = filepath.EvalSymlinks(path); err == nil {
+			if dir := texInstallDir(path); dir != "" {
+				bargs = append(bargs, "--ro-bind", dir, dir)
+			}
+		}
+	}
+
+	// Resources are usually linked into the job's directory so whatever they point to needs to be visible as well
+	infos, err := ioutil.ReadDir(j.Root)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		if info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		target, err := filepath.EvalSymlinks(filepath.Join(j.Root, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		bargs = append(bargs, "--ro-bind", target, target)
+	}
+
+	bargs = append(bargs, "--bind", j.Root, j.Root, "--chdir", j.Root, "--setenv", "HOME", j.Root, "--", compiler)
+	cmd := exec.CommandContext(ctx, "bwrap", append(bargs, args...)...)
+	cmd.Dir = j.Root
+	cmd.Env = env
+	return cmd, nil
+}
+
+// texInstallDir returns the root of the TeX installation the compiler at path belongs to if it lies outside of the
+// system directories that are always mounted in the sandbox, e.g. /home/tex/texlive/2020 for
+// /home/tex/texlive/2020/bin/x86_64-linux/pdflatex.
+func texInstallDir(path string) string {
+	for _, dir := range sandboxSystemDirs {
+		if strings.HasPrefix(path, dir+"/") {
+			return ""
+		}
+	}
+	// Installations keep their binaries in bin/ or bin/<platform>/
+	dir := filepath.Dir(path)
+	for i := 0; i < 2 && dir != "/"; i++ {
+		if filepath.Base(dir) == "bin" {
+			return filepath.Dir(dir)
+		}
+		dir = filepath.Dir(dir)
+	}
+	return filepath.Dir(path)
+}
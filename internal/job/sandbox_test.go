@@ -0,0 +1,198 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/raphaelreyna/go-recon/sources"
+)
+
+func TestJob_command(t *testing.T) {
+	rscDir, err := ioutil.TempDir("", "latte-rsc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rscDir)
+	rscDir, _ = filepath.EvalSymlinks(rscDir)
+	rsc := filepath.Join(rscDir, "logo.png")
+	if err = ioutil.WriteFile(rsc, []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := ioutil.TempDir("", "latte-job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err = os.Symlink(rsc, filepath.Join(root, "logo.png")); err != nil {
+		t.Fatal(err)
+	}
+	j := NewJob(root, nil)
+
+	cmd, err := j.command(context.Background(), "pdflatex", []string{"-halt-on-error", "a.tex"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args := strings.Join(cmd.Args, " "); args != "pdflatex -halt-on-error a.tex" {
+		t.Errorf("expected compiler to be run directly, got %s", args)
+	}
+	if cmd.Dir != root {
+		t.Errorf("expected compiler to be run in %s, got %q", root, cmd.Dir)
+	}
+	env := strings.Join(cmd.Env, "\n")
+	for _, v := range texEnv {
+		if !strings.Contains(env, v) {
+			t.Errorf("expected %s to be set in the compilers environment", v)
+		}
+	}
+
+	j.Opts.Sandbox = SB_Bwrap
+	if cmd, err = j.command(context.Background(), "pdflatex", []string{"-halt-on-error", "a.tex"}); err != nil {
+		t.Fatal(err)
+	}
+	args := strings.Join(cmd.Args, " ")
+	for _, expected := range []string{
+		"bwrap --unshare-all",
+		"--ro-bind " + rsc + " " + rsc,
+		"--bind " + root + " " + root + " --chdir " + root,
+		"-- pdflatex -halt-on-error a.tex",
+	} {
+		if !strings.Contains(args, expected) {
+			t.Errorf("expected %q in sandboxed command, got %s", expected, args)
+		}
+	}
+	if cmd.Dir != root {
+		t.Errorf("expected sandbox to be run in %s, got %q", root, cmd.Dir)
+	}
+}
+
+func TestJob_Compile_Bwrap(t *testing.T) {
+	if err := SB_Bwrap.Available(); err != nil {
+		t.Skip(err)
+	}
+	if _, err := exec.LookPath("pdflatex"); err != nil {
+		t.Skip("pdflatex binary not found in $PATH")
+	}
+
+	rscDir, err := ioutil.TempDir("", "latte-rsc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rscDir)
+	if err = ioutil.WriteFile(filepath.Join(rscDir, "greeting.tex"), []byte("Hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	root, err := ioutil.TempDir("", "latte-job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// The resource is linked in from outside of the job's directory, so it has to be visible in the sandbox too
+	j := NewJob(root, sources.NewDirSourceChain(sources.SoftLink, rscDir))
+	j.Opts.Sandbox = SB_Bwrap
+	j.AddResource("greeting.tex")
+	j.Template = template.Must(template.New("sandboxed").Parse(
+		"\\documentclass{article}\\begin{document}\\input{greeting} {{.name}}\\end{document}",
+	))
+	j.Details = map[string]interface{}{"name": "Alice"}
+
+	pdf, err := j.Compile(context.Background())
+	if err != nil {
+		t.Fatalf("error while compiling in the sandbox: %v", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(root, pdf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF")) {
+		t.Errorf("expected %s to be a PDF", pdf)
+	}
+}
+
+func TestJob_Compile_Latexmkrc(t *testing.T) {
+	// Stand in for latexmk with a script that records its arguments and runs the latexmkrc unless told not to
+	bin, err := ioutil.TempDir("", "latte-bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bin)
+	script := `#!/bin/sh
+echo "$@" > args
+norc=
+for a in "$@"; do case "$a" in -jobname=*) jn="${a#-jobname=}";; -norc) norc=1;; esac; last="$a"; done
+[ -z "$norc" ] && [ -f latexmkrc ] && sh latexmkrc
+cp "$last" "$jn.pdf"
+`
+	if err = ioutil.WriteFile(filepath.Join(bin, "latexmk"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	root, err := ioutil.TempDir("", "latte-job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	cache, err := NewTemplateCache(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A latexmkrc can't be sent along as a resource
+	r := Request{
+		Template:  base64.StdEncoding.EncodeToString([]byte("Hello")),
+		Resources: map[string]string{"latexmkrc": base64.StdEncoding.EncodeToString([]byte("touch pwned"))},
+		Compiler:  CC_Latexmk,
+	}
+	if _, err = r.NewJob(root, nil, cache); err == nil {
+		t.Error("expected a resource named latexmkrc to be rejected")
+	}
+
+	// Nor is one the template wrote with \openout during an earlier pass
+	r.Resources = nil
+	j, err := r.NewJob(root, nil, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(root, "latexmkrc"), []byte("touch pwned"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := j.Compile(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v: %s", err, result)
+	}
+	if _, err = os.Stat(filepath.Join(root, "pwned")); !os.IsNotExist(err) {
+		t.Error("expected latexmkrc not to be run")
+	}
+	args, err := ioutil.ReadFile(filepath.Join(root, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(args), "-norc") {
+		t.Errorf("expected latexmk to be run with -norc, got %s", args)
+	}
+}
+
+func TestTexInstallDir(t *testing.T) {
+	tt := map[string]string{
+		"/usr/bin/pdflatex": "",
+		"/usr/local/texlive/2020/bin/x86_64-linux/pdflatex": "",
+		"/home/tex/texlive/bin/x86_64-linux/pdflatex":       "/home/tex/texlive",
+		"/home/tex/bin/pdflatex":                            "/home/tex",
+		"/srv/pdflatex":                                     "/srv",
+	}
+	for path, expected := range tt {
+		if dir := texInstallDir(path); dir != expected {
+			t.Errorf("expected install dir of %s to be %q, got %q", path, expected, dir)
+		}
+	}
+}
@@ -0,0 +1,614 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/raphaelreyna/latte/internal/metrics"
+	"github.com/raphaelreyna/latte/internal/tracing"
+	"go.mozilla.org/pkcs7"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// SignatureMode controls whether the compiled PDF is digitally signed and whether the signature can be seen on the page.
+type SignatureMode string
+
+var (
+	// SG_None leaves the PDF unsigned.
+	SG_None SignatureMode = ""
+	// SG_Invisible signs the PDF without showing anything on its pages; readers list the signature in their signature panel.
+	SG_Invisible SignatureMode = "invisible"
+	// SG_Visible signs the PDF and shows who signed it and when in a box on one of its pages.
+	SG_Visible SignatureMode = "visible"
+)
+
+func (sm SignatureMode) IsValid() bool {
+	return sm == SG_None || sm == SG_Invisible || sm == SG_Visible
+}
+
+// Signature holds the options for signing the compiled PDF with the certificate LaTTe was configured with.
+type Signature struct {
+	Mode SignatureMode `json:"mode"`
+	// Reason, Location and ContactInfo are recorded in the signature and shown by readers.
+	Reason      string `json:"reason"`
+	Location    string `json:"location"`
+	ContactInfo string `json:"contactInfo"`
+	// Page is the page, counting from 1, a visible signature is shown on; zero means the last page.
+	Page int `json:"page"`
+	// Rect is where a visible signature is shown as [left, bottom, right, top] in points from the bottom left corner of
+	// the page; if it's all zeros, it's shown in the bottom right corner.
+	Rect [4]float64 `json:"rect"`
+}
+
+// IsZero reports whether the PDF shouldn't be signed.
+func (s Signature) IsZero() bool {
+	return s.Mode == SG_None
+}
+
+// Check returns an error if the signature's settings are out of range.
+func (s Signature) Check() error {
+	if !s.Mode.IsValid() {
+		return fmt.Errorf("invalid signature mode %q: must be either invisible or visible", s.Mode)
+	}
+	if s.IsZero() {
+		if s != (Signature{}) {
+			return errors.New("signature has no mode")
+		}
+		return nil
+	}
+	if s.Mode != SG_Visible && (s.Page != 0 || s.Rect != [4]float64{}) {
+		return errors.New("only visible signatures can be given a page or rect")
+	}
+	if s.Page < 0 {
+		return errors.New("signature page must be at least 1")
+	}
+	if r := s.Rect; r != [4]float64{} && (r[0] >= r[2] || r[1] >= r[3]) {
+		return errors.New("signature rect must be given as [left, bottom, right, top]")
+	}
+	return nil
+}
+
+// Signer holds the certificate and private key that PDFs are signed with.
+type Signer struct {
+	Certificate *x509.Certificate
+	// Chain holds the certificates between Certificate and its root, which are included in signatures so that they can
+	// be verified without having to find them.
+	Chain []*x509.Certificate
+	Key   crypto.Signer
+}
+
+// LoadSigner loads the signing certificate and its private key from certFile and keyFile.
+// A PKCS#12 certFile, which must end in .p12 or .pfx, holds the key as well and is decrypted with password; otherwise
+// both files are PEM encoded and keyFile may be left empty if certFile holds the key.
+// Any other certificates found are taken to be the certificate's chain.
+func LoadSigner(certFile, keyFile, password string) (*Signer, error) {
+	data, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		certs []*x509.Certificate
+		key   crypto.Signer
+	)
+	switch strings.ToLower(filepath.Ext(certFile)) {
+	case ".p12", ".pfx":
+		if keyFile != "" {
+			return nil, errors.New("the key is read from the PKCS#12 file so a key file can't be given as well")
+		}
+		pk, cert, caCerts, err := pkcs12.DecodeChain(data, password)
+		if err != nil {
+			return nil, fmt.Errorf("error while decoding %s: %v", certFile, err)
+		}
+		if key, err = signingKey(pk); err != nil {
+			return nil, err
+		}
+		certs = append([]*x509.Certificate{cert}, caCerts...)
+	default:
+		blocks := decodePEM(data)
+		if keyFile != "" {
+			if data, err = ioutil.ReadFile(keyFile); err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, decodePEM(data)...)
+		}
+		for _, b := range blocks {
+			switch {
+			case b.Type == "CERTIFICATE":
+				cert, err := x509.ParseCertificate(b.Bytes)
+				if err != nil {
+					return nil, fmt.Errorf("error while parsing certificate: %v", err)
+				}
+				certs = append(certs, cert)
+			case strings.HasSuffix(b.Type, "PRIVATE KEY"):
+				if key != nil {
+					return nil, errors.New("found more than one private key")
+				}
+				if x509.IsEncryptedPEMBlock(b) {
+					return nil, errors.New("encrypted PEM private keys aren't supported, use a PKCS#12 file instead")
+				}
+				if key, err = parsePrivateKey(b.Bytes); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if key == nil {
+		return nil, errors.New("no private key found")
+	}
+
+	// The signing certificate is whichever one is for the key
+	s := &Signer{Key: key}
+	var others []*x509.Certificate
+	for _, cert := range certs {
+		pub, ok := cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+		if s.Certificate == nil && ok && pub.Equal(key.Public()) {
+			s.Certificate = cert
+		} else {
+			others = append(others, cert)
+		}
+	}
+	if s.Certificate == nil {
+		return nil, errors.New("no certificate found for the private key")
+	}
+	if time.Now().After(s.Certificate.NotAfter) {
+		return nil, fmt.Errorf("signing certificate expired on %s", s.Certificate.NotAfter.Format(time.RFC3339))
+	}
+
+	// Order the chain from the certificate's issuer up, leaving out anything that isn't part of it
+	for cert := s.Certificate; len(s.Chain) < len(others); {
+		var issuer *x509.Certificate
+		for _, other := range others {
+			if bytes.Equal(other.RawSubject, cert.RawIssuer) && other.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil {
+				issuer = other
+				break
+			}
+		}
+		if issuer == nil {
+			break
+		}
+		s.Chain = append(s.Chain, issuer)
+		if bytes.Equal(issuer.RawSubject, issuer.RawIssuer) {
+			break
+		}
+		cert = issuer
+	}
+	return s, nil
+}
+
+// decodePEM returns every PEM block in data.
+func decodePEM(data []byte) []*pem.Block {
+	var blocks []*pem.Block
+	for {
+		var b *pem.Block
+		if b, data = pem.Decode(data); b == nil {
+			return blocks
+		}
+		blocks = append(blocks, b)
+	}
+}
+
+// parsePrivateKey parses an RSA or ECDSA private key in either PKCS#8, PKCS#1 or SEC 1 form.
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	var key interface{}
+	var err error
+	if key, err = x509.ParsePKCS8PrivateKey(der); err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(der); err != nil {
+			if key, err = x509.ParseECPrivateKey(der); err != nil {
+				return nil, errors.New("error while parsing private key: must be an RSA or ECDSA key")
+			}
+		}
+	}
+	return signingKey(key)
+}
+
+// signingKey returns key if it's one that PDFs can be signed with.
+func signingKey(key interface{}) (crypto.Signer, error) {
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported private key type %T: must be an RSA or ECDSA key", key)
+}
+
+// name returns the name of whoever the signing certificate was issued to.
+func (s *Signer) name() string {
+	if cn := s.Certificate.Subject.CommonName; cn != "" {
+		return cn
+	}
+	return s.Certificate.Subject.String()
+}
+
+// signatureSize is how many bytes are set aside in the PDF for the signature, which includes the certificate chain.
+const signatureSize = 16 << 10
+
+// sign signs the PDF at path in place according to the job's signature options.
+func (j *Job) sign(ctx context.Context, path string) (err error) {
+	sig := j.Opts.Signature
+	if sig.IsZero() {
+		return nil
+	}
+	_, span := tracing.Tracer().Start(ctx, "sign pdf")
+	defer func() {
+		if err != nil {
+			tracing.Fail(span, err)
+		}
+		span.End()
+	}()
+
+	if j.Opts.Signer == nil {
+		countFailure(ctx, metrics.FailureSign)
+		return errors.New("no signing certificate has been configured")
+	}
+	for _, f := range []struct {
+		name string
+		text *string
+	}{
+		{"signature reason", &sig.Reason},
+		{"signature location", &sig.Location},
+		{"signature contact info", &sig.ContactInfo},
+	} {
+		text, err := j.fillField(f.name, *f.text)
+		if err != nil {
+			countFailure(ctx, metrics.FailureTemplate)
+			return err
+		}
+		*f.text = strings.TrimSpace(text)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		countFailure(ctx, metrics.FailureIO)
+		return err
+	}
+	if data, err = signPDF(data, j.Opts.Signer, sig, time.Now()); err != nil {
+		countFailure(ctx, metrics.FailureSign)
+		return fmt.Errorf("error while signing pdf: %v", err)
+	}
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		countFailure(ctx, metrics.FailureIO)
+		return err
+	}
+	return nil
+}
+
+// startXRefPattern finds the offset of the last cross-reference section.
+var startXRefPattern = regexp.MustCompile(`startxref\s+(\d+)`)
+
+// signPDF signs the PDF in data as s at time t by appending an incremental update holding a signature field, so that
+// the original bytes, and any signatures they already carry, are left as they are.
+func signPDF(data []byte, s *Signer, sig Signature, t time.Time) ([]byte, error) {
+	if t.Before(s.Certificate.NotBefore) || t.After(s.Certificate.NotAfter) {
+		return nil, fmt.Errorf("signing certificate is only valid from %s until %s",
+			s.Certificate.NotBefore.Format(time.RFC3339), s.Certificate.NotAfter.Format(time.RFC3339))
+	}
+
+	ctx, err := api.ReadContext(bytes.NewReader(data), pdfcpu.NewDefaultConfiguration())
+	if err != nil {
+		return nil, err
+	}
+	if ctx.E != nil {
+		return nil, errors.New("encrypted PDFs can't be signed")
+	}
+	m := startXRefPattern.FindAllSubmatch(data, -1)
+	if m == nil {
+		return nil, errors.New("couldn't find the cross-reference section")
+	}
+	prev, err := strconv.Atoi(string(m[len(m)-1][1]))
+	if err != nil || prev >= len(data) {
+		return nil, errors.New("invalid startxref offset")
+	}
+	// The update's cross-reference section has to be the same kind as the one before it
+	xrefStream := !bytes.HasPrefix(data[prev:], []byte("xref"))
+
+	if err = ctx.EnsurePageCount(); err != nil {
+		return nil, err
+	}
+	pageNr := sig.Page
+	if pageNr == 0 {
+		pageNr = ctx.PageCount
+	}
+	if pageNr > ctx.PageCount {
+		return nil, fmt.Errorf("can't place signature on page %d of a %d page PDF", pageNr, ctx.PageCount)
+	}
+	pageDict, pageRef, _, err := ctx.PageDict(pageNr, false)
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := ctx.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	size := len(ctx.Table)
+	if ctx.Size != nil && *ctx.Size > size {
+		size = *ctx.Size
+	}
+	sigNr, fieldNr, apNr := size, size+1, size+2
+	size += 2
+
+	rect := [4]float64{}
+	if sig.Mode == SG_Visible {
+		size++
+		if rect = sig.Rect; rect == [4]float64{} {
+			pbs, err := ctx.PageBoundaries()
+			if err != nil {
+				return nil, err
+			}
+			// Tuck it into the bottom right corner, half an inch in from the edges
+			mb := pbs[pageNr-1].MediaBox()
+			rect = [4]float64{mb.UR.X - 36 - 200, mb.LL.Y + 36, mb.UR.X - 36, mb.LL.Y + 36 + 50}
+		}
+	}
+
+	// The signature field has to be referenced from both the form and the page it's on
+	fieldRef := *pdfcpu.NewIndirectRef(fieldNr, 0)
+	form := pdfcpu.Dict{}
+	if o, found := catalog.Find("AcroForm"); found {
+		if form, err = ctx.DereferenceDict(o); err != nil {
+			return nil, err
+		}
+		form = form.Clone().(pdfcpu.Dict)
+	}
+	fields, err := ctx.DereferenceArray(form["Fields"])
+	if err != nil {
+		return nil, err
+	}
+	form["Fields"] = append(fields.Clone().(pdfcpu.Array), fieldRef)
+	form["SigFlags"] = pdfcpu.Integer(3)
+	catalog = catalog.Clone().(pdfcpu.Dict)
+	catalog["AcroForm"] = form
+
+	annots, err := ctx.DereferenceArray(pageDict["Annots"])
+	if err != nil {
+		return nil, err
+	}
+	pageDict = pageDict.Clone().(pdfcpu.Dict)
+	pageDict["Annots"] = append(annots.Clone().(pdfcpu.Array), fieldRef)
+
+	var buf bytes.Buffer
+	buf.Write(data)
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	offsets := map[int]int{}
+	gens := map[int]int{}
+	begin := func(nr, gen int) {
+		offsets[nr], gens[nr] = buf.Len(), gen
+		fmt.Fprintf(&buf, "%d %d obj\n", nr, gen)
+	}
+
+	// The byte range and contents are filled in once everything else has been written
+	begin(sigNr, 0)
+	buf.WriteString("<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /adbe.pkcs7.detached /ByteRange ")
+	byteRangeAt := buf.Len()
+	buf.WriteString("[" + strings.Repeat(" ", 40) + "]")
+	buf.WriteString(" /Contents ")
+	contentsAt := buf.Len()
+	buf.WriteString("<" + strings.Repeat("0", 2*signatureSize) + ">")
+	contentsEnd := buf.Len()
+	fmt.Fprintf(&buf, " /M %s /Name %s", pdfString(pdfDate(t)), pdfString(s.name()))
+	for _, e := range []struct{ key, value string }{
+		{"Reason", sig.Reason},
+		{"Location", sig.Location},
+		{"ContactInfo", sig.ContactInfo},
+	} {
+		if e.value != "" {
+			fmt.Fprintf(&buf, " /%s %s", e.key, pdfString(e.value))
+		}
+	}
+	buf.WriteString(" >>\nendobj\n")
+
+	// Print and lock the field so readers don't let it be moved or deleted
+	begin(fieldNr, 0)
+	fmt.Fprintf(&buf, "<< /Type /Annot /Subtype /Widget /FT /Sig /F 132 /T %s /V %d 0 R /P %s /Rect [%s %s %s %s]",
+		pdfString(fmt.Sprintf("Signature%d", len(fields)+1)), sigNr, pageRef.PDFString(),
+		pdfNumber(rect[0]), pdfNumber(rect[1]), pdfNumber(rect[2]), pdfNumber(rect[3]))
+	if sig.Mode == SG_Visible {
+		fmt.Fprintf(&buf, " /AP << /N %d 0 R >>", apNr)
+	}
+	buf.WriteString(" >>\nendobj\n")
+
+	if sig.Mode == SG_Visible {
+		begin(apNr, 0)
+		w, h := rect[2]-rect[0], rect[3]-rect[1]
+		stream := signatureAppearance(w, h, s.name(), t, sig)
+		fmt.Fprintf(&buf, "<< /Type /XObject /Subtype /Form /BBox [0 0 %s %s] "+
+			"/Resources << /Font << /F1 << /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >> >> >> "+
+			"/Length %d >>\nstream\n%s\nendstream\nendobj\n", pdfNumber(w), pdfNumber(h), len(stream), stream)
+	}
+
+	begin(ctx.Root.ObjectNumber.Value(), ctx.Root.GenerationNumber.Value())
+	buf.WriteString(catalog.PDFString() + "\nendobj\n")
+	begin(pageRef.ObjectNumber.Value(), pageRef.GenerationNumber.Value())
+	buf.WriteString(pageDict.PDFString() + "\nendobj\n")
+
+	trailer := fmt.Sprintf("/Root %s /Prev %d", ctx.Root.PDFString(), prev)
+	if ctx.Info != nil {
+		trailer += " /Info " + ctx.Info.PDFString()
+	}
+	if len(ctx.ID) > 0 {
+		trailer += " /ID " + ctx.ID.PDFString()
+	}
+	if xrefStream {
+		writeXRefStream(&buf, offsets, gens, size, trailer)
+	} else {
+		writeXRefTable(&buf, offsets, gens, size, trailer)
+	}
+
+	// Sign everything but the contents, now that where they are is known
+	out := buf.Bytes()
+	byteRange := fmt.Sprintf("[0 %d %d %d", contentsAt, contentsEnd, len(out)-contentsEnd)
+	copy(out[byteRangeAt:], byteRange)
+	signed := make([]byte, 0, len(out)-(contentsEnd-contentsAt))
+	signed = append(append(signed, out[:contentsAt]...), out[contentsEnd:]...)
+
+	sd, err := pkcs7.NewSignedData(signed)
+	if err != nil {
+		return nil, err
+	}
+	sd.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	if err = sd.AddSignerChain(s.Certificate, s.Key, s.Chain, pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, err
+	}
+	sd.Detach()
+	der, err := sd.Finish()
+	if err != nil {
+		return nil, err
+	}
+	if len(der) > signatureSize {
+		return nil, fmt.Errorf("signature is %d bytes, more than the %d set aside for it", len(der), signatureSize)
+	}
+	hex.Encode(out[contentsAt+1:], der)
+	return out, nil
+}
+
+// writeXRefTable writes a cross-reference table for the objects at offsets followed by the trailer.
+func writeXRefTable(buf *bytes.Buffer, offsets, gens map[int]int, size int, trailer string) {
+	start := buf.Len()
+	buf.WriteString("xref\n")
+	for _, sub := range xrefSubsections(offsets) {
+		fmt.Fprintf(buf, "%d %d\n", sub[0], sub[1])
+		for nr := sub[0]; nr < sub[0]+sub[1]; nr++ {
+			fmt.Fprintf(buf, "%010d %05d n \n", offsets[nr], gens[nr])
+		}
+	}
+	fmt.Fprintf(buf, "trailer\n<< /Size %d %s >>\nstartxref\n%d\n%%%%EOF\n", size, trailer, start)
+}
+
+// writeXRefStream writes a cross-reference stream for the objects at offsets, which holds the trailer as well.
+func writeXRefStream(buf *bytes.Buffer, offsets, gens map[int]int, size int, trailer string) {
+	// The stream is an object too, and has to be listed in itself
+	nr := size
+	offsets[nr], gens[nr] = buf.Len(), 0
+	subs := xrefSubsections(offsets)
+	var index []string
+	var entries []byte
+	for _, sub := range subs {
+		index = append(index, strconv.Itoa(sub[0]), strconv.Itoa(sub[1]))
+		for n := sub[0]; n < sub[0]+sub[1]; n++ {
+			off, gen := offsets[n], gens[n]
+			entries = append(entries, 1, byte(off>>24), byte(off>>16), byte(off>>8), byte(off), byte(gen>>8), byte(gen))
+		}
+	}
+	fmt.Fprintf(buf, "%d 0 obj\n<< /Type /XRef /Size %d /Index [%s] /W [1 4 2] %s /Length %d >>\nstream\n",
+		nr, size+1, strings.Join(index, " "), trailer, len(entries))
+	buf.Write(entries)
+	fmt.Fprintf(buf, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", offsets[nr])
+}
+
+// xrefSubsections groups the object numbers in offsets into runs of consecutive numbers, as [first, count] pairs.
+func xrefSubsections(offsets map[int]int) [][2]int {
+	var nrs []int
+	for nr := range offsets {
+		nrs = append(nrs, nr)
+	}
+	sort.Ints(nrs)
+	var subs [][2]int
+	for _, nr := range nrs {
+		if n := len(subs); n > 0 && subs[n-1][0]+subs[n-1][1] == nr {
+			subs[n-1][1]++
+			continue
+		}
+		subs = append(subs, [2]int{nr, 1})
+	}
+	return subs
+}
+
+// signatureAppearance returns the content stream of a visible signature's w by h box.
+func signatureAppearance(w, h float64, name string, t time.Time, sig Signature) string {
+	lines := []string{"Digitally signed by " + name, "Date: " + t.UTC().Format("2006-01-02 15:04:05 MST")}
+	if sig.Reason != "" {
+		lines = append(lines, "Reason: "+sig.Reason)
+	}
+	if sig.Location != "" {
+		lines = append(lines, "Location: "+sig.Location)
+	}
+	// Fit the lines into the box, but don't let them get any bigger than body text
+	size := (h - 8) / (1.2 * float64(len(lines)))
+	if size > 10 {
+		size = 10
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "q 0 0 %s %s re W n\n", pdfNumber(w), pdfNumber(h))
+	fmt.Fprintf(&sb, "0.5 G 1 w 0.5 0.5 %s %s re S\n", pdfNumber(w-1), pdfNumber(h-1))
+	fmt.Fprintf(&sb, "BT 0 g /F1 %s Tf %s TL 4 %s Td\n", pdfNumber(size), pdfNumber(1.2*size), pdfNumber(h-4-size))
+	for i, line := range lines {
+		if i > 0 {
+			sb.WriteString("T* ")
+		}
+		sb.WriteString("(" + winAnsi(line) + ") Tj\n")
+	}
+	sb.WriteString("ET Q")
+	return sb.String()
+}
+
+// winAnsi escapes s for a literal string shown with a WinAnsiEncoding font, replacing what it can't encode with ?.
+func winAnsi(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			sb.WriteString(`\` + string(r))
+		case r >= 0x20 && r < 0x7f:
+			sb.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&sb, `\%03o`, r)
+		default:
+			sb.WriteByte('?')
+		}
+	}
+	return sb.String()
+}
+
+// pdfString returns s as a PDF text string, which is UTF-16 if it isn't plain ASCII.
+func pdfString(s string) string {
+	ascii := true
+	for _, r := range s {
+		if r < 0x20 || r >= 0x7f {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return "(" + strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`).Replace(s) + ")"
+	}
+	var sb strings.Builder
+	sb.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&sb, "%04X", u)
+	}
+	sb.WriteString(">")
+	return sb.String()
+}
+
+// pdfDate returns t as a PDF date string.
+func pdfDate(t time.Time) string {
+	return "D:" + t.UTC().Format("20060102150405") + "Z"
+}
+
+// pdfNumber returns f as a PDF number, without needless trailing zeros.
+func pdfNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,311 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"go.mozilla.org/pkcs7"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// newTestCert creates a CA certificate for key named cn, issued by parent and its key or self-signed if parent is nil.
+func newTestCert(t *testing.T, cn string, key *ecdsa.PrivateKey, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// checkSignature checks that the last signature in the PDF at path covers all of it and was made by signer.
+func checkSignature(t *testing.T, path string, signer *Signer) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := regexp.MustCompile(`/ByteRange \[0 (\d+) (\d+) (\d+) *\]`).FindAllSubmatch(data, -1)
+	if m == nil {
+		t.Fatal("expected the PDF to have a byte range")
+	}
+	var br [3]int
+	for i := range br {
+		br[i], _ = strconv.Atoi(string(m[len(m)-1][i+1]))
+	}
+	if br[1]+br[2] != len(data) {
+		t.Fatalf("expected the byte range to cover the whole PDF, got %v for %d bytes", br, len(data))
+	}
+
+	contents := bytes.TrimRight(data[br[0]+1:br[1]-1], "0")
+	if len(contents)%2 == 1 {
+		contents = append(contents, '0')
+	}
+	der := make([]byte, hex.DecodedLen(len(contents)))
+	if _, err = hex.Decode(der, contents); err != nil {
+		t.Fatal(err)
+	}
+	// The contents are padded with zeros past the end of the signature
+	var raw asn1.RawValue
+	if _, err = asn1.Unmarshal(der, &raw); err != nil {
+		t.Fatal(err)
+	}
+	p7, err := pkcs7.Parse(raw.FullBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7.Content = append(append([]byte{}, data[:br[0]]...), data[br[1]:]...)
+	if err = p7.Verify(); err != nil {
+		t.Fatalf("expected the signature to verify: %v", err)
+	}
+	if cert := p7.GetOnlySigner(); cert == nil || !cert.Equal(signer.Certificate) {
+		t.Error("expected the PDF to have been signed with the signing certificate")
+	}
+}
+
+func TestJob_sign(t *testing.T) {
+	root, err := ioutil.TempDir("", "latte-job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	caKey, key := newTestKey(t), newTestKey(t)
+	ca := newTestCert(t, "Issuing CA", caKey, nil, nil)
+	signer := &Signer{Certificate: newTestCert(t, "Signer", key, ca, caKey), Chain: []*x509.Certificate{ca}, Key: key}
+
+	tt := []struct {
+		Name       string
+		XRefStream bool
+		Signature  Signature
+	}{
+		{Name: "Invisible", Signature: Signature{Mode: SG_Invisible, Reason: "Contract #!.number!#"}},
+		{Name: "Visible", Signature: Signature{Mode: SG_Visible, Location: "Head Office", Page: 1}},
+		{Name: "Cross-reference stream", XRefStream: true, Signature: Signature{Mode: SG_Visible, Rect: [4]float64{36, 36, 236, 86}}},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			path := filepath.Join(root, "job.pdf")
+			writeTestPDF(t, path)
+			if tc.XRefStream {
+				// pdfcpu writes cross-reference streams by default
+				if err := api.OptimizeFile(path, "", nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			original, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			j := NewJob(root, nil)
+			j.Details = map[string]interface{}{"number": 42}
+			j.Opts.Signature, j.Opts.Signer = tc.Signature, signer
+			if err = j.sign(context.Background(), path); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(data, original) {
+				t.Error("expected the signature to be appended to the PDF")
+			}
+			if tc.Signature.Reason != "" && !bytes.Contains(data, []byte("/Reason (Contract 42)")) {
+				t.Error("expected the reason to have been filled in with the details")
+			}
+			if (tc.Signature.Mode == SG_Visible) != bytes.Contains(data, []byte("Digitally signed by Signer")) {
+				t.Error("expected only visible signatures to have an appearance")
+			}
+			checkSignature(t, path, signer)
+
+			// The updated PDF should still read and the field should be in the form and on the page
+			ctx, err := api.ReadContextFile(path)
+			if err != nil {
+				t.Fatalf("expected the signed PDF to be valid: %v", err)
+			}
+			catalog, err := ctx.Catalog()
+			if err != nil {
+				t.Fatal(err)
+			}
+			form, err := ctx.DereferenceDict(catalog["AcroForm"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if flags := form.IntEntry("SigFlags"); flags == nil || *flags != 3 {
+				t.Errorf("expected the form's signature flags to be 3, got %v", flags)
+			}
+			page, _, _, err := ctx.PageDict(1, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(form.ArrayEntry("Fields")) != 1 || len(page.ArrayEntry("Annots")) != 1 {
+				t.Error("expected the signature field to be in the form and on the page")
+			}
+		})
+	}
+
+	j := NewJob(root, nil)
+	j.Opts.Signature = Signature{Mode: SG_Invisible}
+	if err = j.sign(context.Background(), filepath.Join(root, "job.pdf")); err == nil || !strings.Contains(err.Error(), "no signing certificate") {
+		t.Errorf("expected an error signing without a certificate, got %v", err)
+	}
+}
+
+func TestLoadSigner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "latte-signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rootKey, caKey, key := newTestKey(t), newTestKey(t), newTestKey(t)
+	root := newTestCert(t, "Root CA", rootKey, nil, nil)
+	ca := newTestCert(t, "Issuing CA", caKey, root, rootKey)
+	cert := newTestCert(t, "Signer", key, ca, caKey)
+
+	// Bundles aren't always in order
+	var certPEM bytes.Buffer
+	for _, c := range []*x509.Certificate{root, cert, ca} {
+		pem.Encode(&certPEM, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err = ioutil.WriteFile(certFile, certPEM.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := LoadSigner(certFile, keyFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Certificate.Equal(cert) {
+		t.Errorf("expected the signing certificate to be %s, got %s", cert.Subject, s.Certificate.Subject)
+	}
+	if len(s.Chain) != 2 || !s.Chain[0].Equal(ca) || !s.Chain[1].Equal(root) {
+		t.Errorf("expected the chain to be the issuing CA and then the root CA, got %d certificates", len(s.Chain))
+	}
+
+	// The key may be in the same file as the certificates
+	if err = ioutil.WriteFile(certFile, append(certPEM.Bytes(), keyPEM...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadSigner(certFile, "", ""); err != nil {
+		t.Errorf("unexpected error loading a combined file: %v", err)
+	}
+
+	// PKCS#12 files hold the key along with the certificates
+	pfx, err := pkcs12.Encode(rand.Reader, key, cert, []*x509.Certificate{root, ca}, "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pfxFile := filepath.Join(dir, "signer.p12")
+	if err = ioutil.WriteFile(pfxFile, pfx, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = LoadSigner(pfxFile, "", "s3cret"); err != nil {
+		t.Fatalf("unexpected error loading a PKCS#12 file: %v", err)
+	}
+	if !s.Certificate.Equal(cert) || len(s.Chain) != 2 {
+		t.Error("expected the PKCS#12 file to give the same certificate and chain")
+	}
+	if _, err = LoadSigner(pfxFile, "", "wrong"); err == nil {
+		t.Error("expected an error for the wrong PKCS#12 password")
+	}
+
+	// But there must be a certificate for it
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+	if err = ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(certFile, certPEM.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadSigner(certFile, keyFile, ""); err == nil || !strings.Contains(err.Error(), "no certificate found") {
+		t.Errorf("expected an error for a key without a certificate, got %v", err)
+	}
+}
+
+func TestSignature_Check(t *testing.T) {
+	tt := []struct {
+		Name      string
+		Signature Signature
+		Expected  string
+	}{
+		{Name: "None"},
+		{Name: "Invisible", Signature: Signature{Mode: SG_Invisible, Reason: "Approved", Location: "Head Office"}},
+		{Name: "Visible", Signature: Signature{Mode: SG_Visible, Page: 2, Rect: [4]float64{36, 36, 236, 86}}},
+		{Name: "Unknown mode", Signature: Signature{Mode: "stamped"}, Expected: "invalid signature mode"},
+		{Name: "No mode", Signature: Signature{Reason: "Approved"}, Expected: "signature has no mode"},
+		{Name: "Invisible page", Signature: Signature{Mode: SG_Invisible, Page: 1}, Expected: "only visible signatures"},
+		{Name: "Negative page", Signature: Signature{Mode: SG_Visible, Page: -1}, Expected: "at least 1"},
+		{Name: "Flipped rect", Signature: Signature{Mode: SG_Visible, Rect: [4]float64{236, 86, 36, 36}}, Expected: "[left, bottom, right, top]"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := tc.Signature.Check()
+			if tc.Expected == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.Expected) {
+				t.Fatalf("expected error containing %q, got %v", tc.Expected, err)
+			}
+		})
+	}
+}
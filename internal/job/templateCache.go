@@ -2,7 +2,9 @@ package job
 
 import (
 	"sync"
+
 	lru "github.com/hashicorp/golang-lru"
+	"github.com/raphaelreyna/latte/internal/metrics"
 )
 
 type TemplateCache struct {
@@ -13,7 +15,10 @@ type TemplateCache struct {
 func NewTemplateCache(n int) (*TemplateCache, error) {
 	var err error
 	tc := &TemplateCache{}
-	if tc.cache, err = lru.New(n); err != nil {
+	tc.cache, err = lru.NewWithEvict(n, func(key, val interface{}) {
+		metrics.TemplateCacheEvictions.Inc()
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -21,7 +26,13 @@ func NewTemplateCache(n int) (*TemplateCache, error) {
 }
 
 func (tc *TemplateCache) Get(key string) (interface{}, bool) {
-	return tc.cache.Get(key)
+	val, exists := tc.cache.Get(key)
+	if exists {
+		metrics.TemplateCacheHits.Inc()
+	} else {
+		metrics.TemplateCacheMisses.Inc()
+	}
+	return val, exists
 }
 
 func (tc *TemplateCache) Add(key string, val interface{}) bool {
@@ -0,0 +1,70 @@
+package job
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TeXError is an error reported by TeX while compiling the filled-in tex file.
+type TeXError struct {
+	// Message is TeX's description of the error, e.g. "Undefined control sequence."
+	Message string
+	// Line is the line of the filled-in tex file the error occurred on, or 0 if TeX didn't say.
+	Line int
+	// Context is the text TeX was reading when the error occurred.
+	Context string
+}
+
+func (e TeXError) Error() string {
+	var sb strings.Builder
+	if e.Line > 0 {
+		fmt.Fprintf(&sb, "line %d: ", e.Line)
+	}
+	sb.WriteString(e.Message)
+	if e.Context != "" {
+		fmt.Fprintf(&sb, " (at %q)", e.Context)
+	}
+	return sb.String()
+}
+
+var texLineRe = regexp.MustCompile(`^l\.(\d+) ?(.*)$`)
+
+// texErrorContextLines is how many lines after an error message are searched for the line number.
+const texErrorContextLines = 8
+
+// ParseTeXErrors finds the errors TeX reported in its output, in the order they occurred.
+func ParseTeXErrors(output string) []TeXError {
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	var errs []TeXError
+	for i := 0; i < len(lines); i++ {
+		if !strings.HasPrefix(lines[i], "! ") {
+			continue
+		}
+		e := TeXError{Message: strings.TrimSpace(strings.TrimPrefix(lines[i], "! "))}
+		// TeX follows the first error with this when halting, it's not an error of its own
+		if strings.HasPrefix(e.Message, "==> Fatal error occurred") {
+			continue
+		}
+		for k := i + 1; k < len(lines) && k <= i+texErrorContextLines; k++ {
+			if strings.HasPrefix(lines[k], "! ") {
+				break
+			}
+			if m := texLineRe.FindStringSubmatch(lines[k]); m != nil {
+				e.Line, _ = strconv.Atoi(m[1])
+				e.Context = strings.TrimSpace(m[2])
+				i = k
+				break
+			}
+		}
+		errs = append(errs, e)
+	}
+	return errs
+}
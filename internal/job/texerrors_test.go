@@ -0,0 +1,58 @@
+package job
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTeXErrors(t *testing.T) {
+	tt := []struct {
+		Name     string
+		Output   string
+		Expected []TeXError
+	}{
+		{
+			Name: "Undefined control sequence",
+			Output: `This is pdfTeX, Version 3.14159265-2.6-1.40.21 (TeX Live 2020) (preloaded format=pdflatex)
+(./abc_filled-in.tex
+LaTeX2e <2020-02-02> patch level 2
+! Undefined control sequence.
+l.12 Total: \amount
+                   {42}
+!  ==> Fatal error occurred, no output PDF file produced!
+Transcript written on abc.log.
+`,
+			Expected: []TeXError{
+				{Message: "Undefined control sequence.", Line: 12, Context: `Total: \amount`},
+			},
+		},
+		{
+			Name: "Missing package",
+			Output: `! LaTeX Error: File ` + "`" + `missing.sty' not found.
+
+Type X to quit or <RETURN> to proceed,
+or enter new name. (Default extension: sty)
+
+Enter file name:
+! Emergency stop.
+<read *>
+`,
+			Expected: []TeXError{
+				{Message: "LaTeX Error: File `missing.sty' not found."},
+				{Message: "Emergency stop."},
+			},
+		},
+		{
+			Name:   "No errors",
+			Output: "Output written on abc.pdf (1 page, 12345 bytes).\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			if errs := ParseTeXErrors(tc.Output); !reflect.DeepEqual(errs, tc.Expected) {
+				t.Errorf("expected %+v, got %+v", tc.Expected, errs)
+			}
+		})
+	}
+}
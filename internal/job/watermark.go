@@ -0,0 +1,100 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/raphaelreyna/latte/internal/metrics"
+	"github.com/raphaelreyna/latte/internal/tracing"
+)
+
+// DefaultWatermarkOpacity is how opaque watermarks are unless their opacity is set.
+const DefaultWatermarkOpacity = 0.5
+
+// Watermark is text, such as DRAFT or COPY, stamped across the pages of the compiled PDF.
+type Watermark struct {
+	// Text is filled in with the details before it is stamped.
+	Text string `json:"text"`
+	// Opacity is between 0 and 1, where 1 is fully opaque; zero uses DefaultWatermarkOpacity.
+	Opacity float64 `json:"opacity"`
+	// Angle is how many degrees, between -180 and 180, the text is rotated counterclockwise.
+	Angle float64 `json:"angle"`
+	// Pages selects the pages to stamp, e.g. 1-3,5; empty means all of them.
+	Pages string `json:"pages"`
+}
+
+// IsZero reports whether there's no watermark.
+func (wm Watermark) IsZero() bool {
+	return wm.Text == ""
+}
+
+// Check returns an error if the watermark's settings are out of range.
+func (wm Watermark) Check() error {
+	if wm.IsZero() {
+		if wm.Opacity != 0 || wm.Angle != 0 || wm.Pages != "" {
+			return errors.New("watermark has no text")
+		}
+		return nil
+	}
+	if wm.Opacity < 0 || wm.Opacity > 1 {
+		return errors.New("watermark opacity must be between 0 and 1")
+	}
+	if wm.Angle < -180 || wm.Angle > 180 {
+		return errors.New("watermark angle must be between -180 and 180 degrees")
+	}
+	if wm.Pages != "" {
+		if err := CheckPages(wm.Pages); err != nil {
+			return fmt.Errorf("watermark: %v", err)
+		}
+	}
+	return nil
+}
+
+// stamp stamps the job's watermark, if it has one, onto the pages of the PDF at path in place.
+func (j *Job) stamp(ctx context.Context, path string) (err error) {
+	wm := j.Opts.Watermark
+	if wm.IsZero() {
+		return nil
+	}
+	_, span := tracing.Tracer().Start(ctx, "stamp watermark")
+	defer func() {
+		if err != nil {
+			tracing.Fail(span, err)
+		}
+		span.End()
+	}()
+
+	text, err := j.fillField("watermark text", wm.Text)
+	if err != nil {
+		countFailure(ctx, metrics.FailureTemplate)
+		return err
+	}
+	if text = strings.TrimSpace(text); text == "" {
+		return nil
+	}
+	opacity := wm.Opacity
+	if opacity == 0 {
+		opacity = DefaultWatermarkOpacity
+	}
+	// The description is only ever made up of numbers so that it can't be mistaken for other settings
+	desc := fmt.Sprintf("rotation:%g, opacity:%g", wm.Angle, opacity)
+	pwm, err := api.TextWatermark(text, desc, true, false, pdfcpu.POINTS)
+	if err != nil {
+		countFailure(ctx, metrics.FailureStamp)
+		return fmt.Errorf("error while creating watermark: %v", err)
+	}
+
+	var pages []string
+	if wm.Pages != "" {
+		pages = strings.Split(wm.Pages, ",")
+	}
+	if err = api.AddWatermarksFile(path, "", pages, pwm, nil); err != nil {
+		countFailure(ctx, metrics.FailureStamp)
+		return fmt.Errorf("error while stamping watermark: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJob_stamp(t *testing.T) {
+	root, err := ioutil.TempDir("", "latte-job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	path := filepath.Join(root, "job.pdf")
+	writeTestPDF(t, path)
+
+	j := NewJob(root, nil)
+	j.Details = map[string]interface{}{"status": "DRAFT"}
+	j.Opts.Watermark = Watermark{Text: "#!.status!#", Angle: 45, Pages: "1"}
+	if err = j.stamp(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+
+	// pdfcpu puts stamps in an optional content group named after them
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data = append(data, inflateStreams(data)...); !bytes.Contains(data, []byte("(Watermark)")) {
+		t.Error("expected the PDF to have been stamped")
+	}
+
+	j.Opts.Watermark.Text = "#!.missing!#"
+	if err = j.stamp(context.Background(), path); err == nil || !strings.Contains(err.Error(), "watermark text") {
+		t.Errorf("expected an error filling in the watermark text, got %v", err)
+	}
+}
+
+func TestWatermark_Check(t *testing.T) {
+	tt := []struct {
+		Name      string
+		Watermark Watermark
+		Expected  string
+	}{
+		{Name: "None"},
+		{Name: "Open range", Watermark: Watermark{Text: "COPY", Opacity: 0.2, Angle: -30, Pages: "2-"}, Expected: "watermark: invalid pages"},
+		{Name: "Page range", Watermark: Watermark{Text: "COPY", Opacity: 1, Angle: 180, Pages: "1-2,4"}},
+		{Name: "No text", Watermark: Watermark{Opacity: 0.2}, Expected: "watermark has no text"},
+		{Name: "Opacity", Watermark: Watermark{Text: "COPY", Opacity: 1.5}, Expected: "opacity must be between 0 and 1"},
+		{Name: "Angle", Watermark: Watermark{Text: "COPY", Angle: -270}, Expected: "angle must be between -180 and 180"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := tc.Watermark.Check()
+			if tc.Expected == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.Expected) {
+				t.Fatalf("expected error containing %q, got %v", tc.Expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package job
+
+import (
+	"archive/zip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// WriteZip writes a zip archive of the working directory to w, following any links to resources.
+// Hidden files and directories, such as .git, are left out.
+func (j *Job) WriteZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	if err := zipDir(zw, j.Root, ""); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// zipDir adds the contents of dir to zw, naming them relative to prefix.
+func zipDir(zw *zip.Writer, dir, prefix string) error {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		fpath := filepath.Join(dir, info.Name())
+		name := path.Join(prefix, info.Name())
+		// Resources are usually links, so look at what they point to
+		if info, err = os.Stat(fpath); err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if err = zipDir(zw, fpath, name); err != nil {
+				return err
+			}
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		if err = zipFile(zw, fpath, name, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func zipFile(zw *zip.Writer, fpath, name string, info os.FileInfo) error {
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	hdr.Method = zip.Deflate
+
+	f, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fw, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, f)
+	return err
+}
@@ -0,0 +1,80 @@
+package job
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"text/template"
+)
+
+func TestJob_WriteZip(t *testing.T) {
+	rscDir, err := ioutil.TempDir("", "latte-rsc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rscDir)
+	if err = ioutil.WriteFile(filepath.Join(rscDir, "logo.png"), []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := ioutil.TempDir("", "latte-job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, dir := range []string{"fonts", ".git"} {
+		if err = os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(filepath.Join(root, dir, "a"), []byte("a"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = os.Symlink(filepath.Join(rscDir, "logo.png"), filepath.Join(root, "logo.png")); err != nil {
+		t.Fatal(err)
+	}
+
+	j := NewJob(root, nil)
+	j.Template = template.Must(template.New("").Delims("#!", "!#").Parse(`Hello #!.name!#`))
+	j.Details = map[string]interface{}{"name": "Alice"}
+	if err = j.Fill(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	tex, err := ioutil.ReadFile(j.TexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(tex) != "Hello Alice" {
+		t.Errorf("expected filled-in tex file to contain %q, got %q", "Hello Alice", tex)
+	}
+
+	var buf bytes.Buffer
+	if err = j.WriteZip(&buf); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+
+	expected := []string{filepath.Base(j.TexFile), "fonts/a", "logo.png"}
+	sort.Strings(expected)
+	if len(names) != len(expected) {
+		t.Fatalf("expected zip to contain %v, got %v", expected, names)
+	}
+	for i := range names {
+		if names[i] != expected[i] {
+			t.Fatalf("expected zip to contain %v, got %v", expected, names)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Package logging provides the structured, leveled logger used throughout LaTTe.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Format is the encoding used for log entries.
+type Format string
+
+var (
+	// FormatJSON encodes each log entry as a JSON object.
+	FormatJSON Format = "json"
+	// FormatLogfmt encodes each log entry as a line of key=value pairs.
+	FormatLogfmt Format = "logfmt"
+)
+
+func (f Format) IsValid() bool {
+	return f == FormatJSON || f == FormatLogfmt
+}
+
+// New creates a logger that writes entries of at least the given level to w.
+// An empty format defaults to logfmt and an empty level defaults to info.
+func New(w io.Writer, format Format, level string) (*logrus.Logger, error) {
+	l := logrus.New()
+	l.SetOutput(w)
+
+	switch format {
+	case FormatJSON:
+		l.SetFormatter(&logrus.JSONFormatter{})
+	case FormatLogfmt, "":
+		l.SetFormatter(&logrus.TextFormatter{DisableColors: true, FullTimestamp: true})
+	default:
+		return nil, fmt.Errorf("invalid log format: %s", format)
+	}
+
+	if level != "" {
+		lvl, err := logrus.ParseLevel(level)
+		if err != nil {
+			return nil, err
+		}
+		l.SetLevel(lvl)
+	}
+
+	return l, nil
+}
+
+// Discard returns a logger that throws away everything it is given.
+func Discard() *logrus.Logger {
+	l := logrus.New()
+	l.SetOutput(ioutil.Discard)
+	return l
+}
+
+type loggerKey struct{}
+
+// NewContext returns a copy of ctx that carries l.
+func NewContext(ctx context.Context, l logrus.FieldLogger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the logger carried by ctx, or the standard logger if ctx carries none.
+func FromContext(ctx context.Context) logrus.FieldLogger {
+	if l, ok := ctx.Value(loggerKey{}).(logrus.FieldLogger); ok {
+		return l
+	}
+	return logrus.StandardLogger()
+}
@@ -0,0 +1,120 @@
+// Package metrics holds the Prometheus collectors used to instrument LaTTe.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "latte"
+
+var (
+	// Requests counts the HTTP requests handled, by route and status code.
+	Requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests handled, by route and status code.",
+	}, []string{"route", "code"})
+
+	// RequestDuration observes how long HTTP requests took to handle, by route.
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests, by route.",
+		Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 20, 30, 60},
+	}, []string{"route"})
+
+	// CompileDuration observes how long compilations took, by compiler and number of passes.
+	CompileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "compile_duration_seconds",
+		Help:      "Time taken to compile a filled in template, by compiler and number of passes.",
+		Buckets:   []float64{.25, .5, 1, 2, 4, 8, 15, 30, 60},
+	}, []string{"compiler", "passes"})
+
+	// CompileFailures counts failed compilations, by the category of failure.
+	CompileFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "compile_failures_total",
+		Help:      "Number of failed compilations, by category of failure.",
+	}, []string{"category"})
+
+	// TemplateCacheHits counts lookups that found a parsed template in the cache.
+	TemplateCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "template_cache_hits_total",
+		Help:      "Number of template cache lookups that found a parsed template.",
+	})
+
+	// TemplateCacheMisses counts lookups that did not find a parsed template in the cache.
+	TemplateCacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "template_cache_misses_total",
+		Help:      "Number of template cache lookups that did not find a parsed template.",
+	})
+
+	// TemplateCacheEvictions counts parsed templates evicted from the cache.
+	TemplateCacheEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "template_cache_evictions_total",
+		Help:      "Number of parsed templates evicted from the template cache.",
+	})
+
+	// DBDuration observes how long database operations took, by operation.
+	DBDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_operation_duration_seconds",
+		Help:      "Time taken by database operations, by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	// JobsQueued tracks the jobs that have been accepted but have not started compiling.
+	JobsQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "jobs_queued",
+		Help:      "Number of jobs accepted that have not started compiling.",
+	})
+
+	// JobsActive tracks the jobs currently compiling.
+	JobsActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "jobs_active",
+		Help:      "Number of jobs currently compiling.",
+	})
+)
+
+// Compile failure categories
+const (
+	FailureTemplate    = "template"
+	FailureCompiler    = "compiler"
+	FailureCanceled    = "canceled"
+	FailureIO          = "io"
+	FailureConvert     = "convert"
+	FailureConformance = "conformance"
+	FailureEncrypt     = "encrypt"
+	FailureStamp       = "stamp"
+	FailureSign        = "sign"
+)
+
+// Registry holds all of LaTTe's collectors along with the standard Go and process collectors.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Requests, RequestDuration,
+		CompileDuration, CompileFailures,
+		TemplateCacheHits, TemplateCacheMisses, TemplateCacheEvictions,
+		DBDuration,
+		JobsQueued, JobsActive,
+	)
+}
+
+// Handler serves the metrics in Registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
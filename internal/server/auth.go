@@ -0,0 +1,408 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/raphaelreyna/latte/internal/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// Scope is a permission that may be granted to an authenticated client.
+type Scope string
+
+var (
+	// ScopeGenerate allows a client to generate PDFs.
+	ScopeGenerate Scope = "generate"
+	// ScopeRegister allows a client to register templates, details and resources.
+	ScopeRegister Scope = "register"
+	// ScopeAdmin grants every other scope.
+	ScopeAdmin Scope = "admin"
+)
+
+func (s Scope) IsValid() bool {
+	return s == ScopeGenerate || s == ScopeRegister || s == ScopeAdmin
+}
+
+// Identity describes an authenticated client.
+type Identity struct {
+	Name   string
+	Scopes []Scope
+}
+
+// HasScope reports whether the identity was granted scope sc, either directly or through ScopeAdmin.
+func (id *Identity) HasScope(sc Scope) bool {
+	if id == nil {
+		return false
+	}
+	for _, s := range id.Scopes {
+		if s == sc || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrNoCredentials should be returned by an Authenticator when a request carries none of the credentials it handles.
+var ErrNoCredentials = errors.New("no credentials provided")
+
+// Authenticator checks the credentials carried by a request.
+type Authenticator interface {
+	// Authenticate should return the identity of the client that sent r.
+	// If r carries no credentials the Authenticator understands, error should be ErrNoCredentials.
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// AuthChain tries each of its Authenticators in order, returning the first identity found.
+type AuthChain []Authenticator
+
+func (ac AuthChain) Authenticate(r *http.Request) (*Identity, error) {
+	for _, a := range ac {
+		id, err := a.Authenticate(r)
+		if err == ErrNoCredentials {
+			continue
+		}
+		return id, err
+	}
+	return nil, ErrNoCredentials
+}
+
+type identityKey struct{}
+
+// IdentityFromContext returns the identity of the client that was authenticated for the request that ctx belongs to.
+func IdentityFromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey{}).(*Identity)
+	return id
+}
+
+// authorize wraps h so that it only runs for clients that were granted scope sc.
+// All requests are let through if the server has no Authenticator.
+func (s *Server) authorize(sc Scope, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.auth == nil {
+			h(w, r)
+			return
+		}
+
+		log := logging.FromContext(r.Context())
+		id, err := s.auth.Authenticate(r)
+		if err != nil {
+			if err != ErrNoCredentials {
+				log.WithError(err).Warn("authentication failed")
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="latte"`)
+			s.respondError(w, r, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !id.HasScope(sc) {
+			log.WithFields(logrus.Fields{"client": id.Name, "scope": sc}).Warn("client is missing scope")
+			s.respondError(w, r, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		h(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, id)))
+	}
+}
+
+// APIKeyHeader is the header from which APIKeys reads a clients key.
+const APIKeyHeader = "X-API-Key"
+
+// APIKeys authenticates clients by a static key sent in the X-API-Key header.
+// Keys are held as their SHA-256 sums.
+type APIKeys map[[sha256.Size]byte]*Identity
+
+// Add grants the given scopes to the client holding key.
+func (ak APIKeys) Add(key, name string, scopes ...Scope) {
+	ak[sha256.Sum256([]byte(key))] = &Identity{Name: name, Scopes: scopes}
+}
+
+func (ak APIKeys) Authenticate(r *http.Request) (*Identity, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	id, exists := ak[sha256.Sum256([]byte(key))]
+	if !exists {
+		return nil, errors.New("unknown api key")
+	}
+	return id, nil
+}
+
+// ParseAPIKeys reads API keys from r, one per line, in the form:
+//
+//	KEY NAME SCOPE[,SCOPE...]
+//
+// Blank lines and lines starting with '#' are ignored.
+func ParseAPIKeys(r io.Reader) (APIKeys, error) {
+	ak := APIKeys{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := ak.addLine(line); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+	}
+	return ak, scanner.Err()
+}
+
+func (ak APIKeys) addLine(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return errors.New("expected KEY NAME SCOPES")
+	}
+	var scopes []Scope
+	for _, s := range strings.Split(fields[2], ",") {
+		sc := Scope(s)
+		if !sc.IsValid() {
+			return fmt.Errorf("invalid scope: %s", s)
+		}
+		scopes = append(scopes, sc)
+	}
+	ak.Add(fields[0], fields[1], scopes...)
+	return nil
+}
+
+// JWTAuth authenticates clients by a JWT sent as a bearer token in the Authorization header.
+// Tokens must be signed with an asymmetric algorithm and are verified against a local set of public keys.
+// The clients name is taken from the "sub" claim and its scopes from the space separated "scope" claim.
+type JWTAuth struct {
+	// Keys holds the public keys used to verify tokens, indexed by key ID.
+	// A key stored under the empty ID is used for tokens whose key ID is missing or unknown.
+	Keys map[string]interface{}
+	// Issuer, if not empty, is required to match the "iss" claim.
+	Issuer string
+	// Audience, if not empty, is required to be found in the "aud" claim.
+	Audience string
+}
+
+var jwtMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+func (ja *JWTAuth) Authenticate(r *http.Request) (*Identity, error) {
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return nil, ErrNoCredentials
+	}
+
+	claims := jwt.MapClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(jwtMethods))
+	_, err := parser.ParseWithClaims(strings.TrimPrefix(h, "Bearer "), claims, ja.keyFunc)
+	if err != nil {
+		return nil, err
+	}
+	if ja.Issuer != "" && !claims.VerifyIssuer(ja.Issuer, true) {
+		return nil, errors.New("token has invalid issuer")
+	}
+	if ja.Audience != "" && !claims.VerifyAudience(ja.Audience, true) {
+		return nil, errors.New("token has invalid audience")
+	}
+
+	id := &Identity{}
+	id.Name, _ = claims["sub"].(string)
+	scope, _ := claims["scope"].(string)
+	for _, s := range strings.Fields(scope) {
+		if sc := Scope(s); sc.IsValid() {
+			id.Scopes = append(id.Scopes, sc)
+		}
+	}
+	return id, nil
+}
+
+func (ja *JWTAuth) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, exists := ja.Keys[kid]
+	if !exists {
+		key, exists = ja.Keys[""]
+	}
+	if !exists {
+		return nil, fmt.Errorf("unknown key id: %q", kid)
+	}
+	return key, nil
+}
+
+// LoadJWTKeys reads the public keys used to verify JWTs from the file at path.
+// The file may either be a JWKS document or a PEM encoded public key or certificate.
+func LoadJWTKeys(path string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if block, _ := pem.Decode(data); block != nil {
+		var key interface{}
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			key = cert.PublicKey
+		default:
+			if key, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+				return nil, err
+			}
+		}
+		return map[string]interface{}{"": key}, nil
+	}
+
+	return parseJWKS(data)
+}
+
+func parseJWKS(data []byte) (map[string]interface{}, error) {
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("error while parsing jwks: %v", err)
+	}
+
+	// b64 decodes the base64url encoded, big-endian integer named field of the key kid, which mustn't be empty
+	b64 := func(kid, field, s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s for key %q: %v", field, kid, err)
+		}
+		if len(b) == 0 {
+			return nil, fmt.Errorf("missing %s for key %q", field, kid)
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	keys := map[string]interface{}{}
+	for _, k := range jwks.Keys {
+		switch k.Kty {
+		case "RSA":
+			n, err := b64(k.Kid, "n", k.N)
+			if err != nil {
+				return nil, err
+			}
+			e, err := b64(k.Kid, "e", k.E)
+			if err != nil {
+				return nil, err
+			}
+			if !e.IsInt64() || e.Int64() > math.MaxInt32 {
+				return nil, fmt.Errorf("invalid e for key %q: exponent is too large", k.Kid)
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				return nil, fmt.Errorf("unsupported curve for key %q: %s", k.Kid, k.Crv)
+			}
+			x, err := b64(k.Kid, "x", k.X)
+			if err != nil {
+				return nil, err
+			}
+			y, err := b64(k.Kid, "y", k.Y)
+			if err != nil {
+				return nil, err
+			}
+			if !curve.IsOnCurve(x, y) {
+				return nil, fmt.Errorf("invalid EC key %q: point isn't on the %s curve", k.Kid, k.Crv)
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		case "OKP":
+			if k.Crv != "Ed25519" {
+				return nil, fmt.Errorf("unsupported curve for key %q: %s", k.Kid, k.Crv)
+			}
+			x, err := base64.RawURLEncoding.DecodeString(k.X)
+			if err != nil || len(x) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("invalid Ed25519 key %q", k.Kid)
+			}
+			keys[k.Kid] = ed25519.PublicKey(x)
+		default:
+			return nil, fmt.Errorf("unsupported key type for key %q: %s", k.Kid, k.Kty)
+		}
+	}
+	return keys, nil
+}
+
+// NewAuthenticatorFromEnv builds an Authenticator from the LATTE_API_KEYS, LATTE_API_KEYS_FILE,
+// LATTE_JWT_KEYS_FILE, LATTE_JWT_ISSUER and LATTE_JWT_AUDIENCE environment variables.
+// A nil Authenticator is returned if none of them are set.
+func NewAuthenticatorFromEnv() (Authenticator, error) {
+	var chain AuthChain
+
+	ak := APIKeys{}
+	if path := os.Getenv("LATTE_API_KEYS_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if ak, err = ParseAPIKeys(f); err != nil {
+			return nil, fmt.Errorf("error while parsing %s: %v", path, err)
+		}
+	}
+	if keys := os.Getenv("LATTE_API_KEYS"); keys != "" {
+		for _, line := range strings.Split(keys, ";") {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			if err := ak.addLine(line); err != nil {
+				return nil, fmt.Errorf("error while parsing LATTE_API_KEYS: %v", err)
+			}
+		}
+	}
+	if len(ak) > 0 {
+		chain = append(chain, ak)
+	}
+
+	if path := os.Getenv("LATTE_JWT_KEYS_FILE"); path != "" {
+		keys, err := LoadJWTKeys(path)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, &JWTAuth{
+			Keys:     keys,
+			Issuer:   os.Getenv("LATTE_JWT_ISSUER"),
+			Audience: os.Getenv("LATTE_JWT_AUDIENCE"),
+		})
+	}
+
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	return chain, nil
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/raphaelreyna/latte/internal/logging"
+)
+
+func TestServer_Authorize(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + token
+	}
+
+	apiKeys, err := ParseAPIKeys(strings.NewReader(`
+# key name scopes
+generate-key alice generate
+admin-key bob admin
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{
+		log: logging.Discard(),
+		auth: AuthChain{apiKeys, &JWTAuth{
+			Keys:   map[string]interface{}{"": &key.PublicKey},
+			Issuer: "latte-test",
+		}},
+	}
+	h := s.authorize(ScopeRegister, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(IdentityFromContext(r.Context()).Name))
+	})
+
+	exp := time.Now().Add(time.Hour).Unix()
+	tt := []struct {
+		Name         string
+		Header       string
+		Value        string
+		ExpectedCode int
+		ExpectedName string
+	}{
+		{Name: "No credentials", ExpectedCode: http.StatusUnauthorized},
+		{Name: "Unknown api key", Header: APIKeyHeader, Value: "nope", ExpectedCode: http.StatusUnauthorized},
+		{Name: "Api key missing scope", Header: APIKeyHeader, Value: "generate-key", ExpectedCode: http.StatusForbidden},
+		{Name: "Admin api key", Header: APIKeyHeader, Value: "admin-key", ExpectedCode: http.StatusOK, ExpectedName: "bob"},
+		{
+			Name:         "JWT with scope",
+			Header:       "Authorization",
+			Value:        sign(jwt.MapClaims{"sub": "carol", "iss": "latte-test", "scope": "generate register", "exp": exp}),
+			ExpectedCode: http.StatusOK,
+			ExpectedName: "carol",
+		},
+		{
+			Name:         "JWT missing scope",
+			Header:       "Authorization",
+			Value:        sign(jwt.MapClaims{"sub": "carol", "iss": "latte-test", "scope": "generate", "exp": exp}),
+			ExpectedCode: http.StatusForbidden,
+		},
+		{
+			Name:         "JWT wrong issuer",
+			Header:       "Authorization",
+			Value:        sign(jwt.MapClaims{"sub": "carol", "iss": "mallory", "scope": "admin", "exp": exp}),
+			ExpectedCode: http.StatusUnauthorized,
+		},
+		{
+			Name:         "Expired JWT",
+			Header:       "Authorization",
+			Value:        sign(jwt.MapClaims{"sub": "carol", "iss": "latte-test", "scope": "admin", "exp": time.Now().Add(-time.Hour).Unix()}),
+			ExpectedCode: http.StatusUnauthorized,
+		},
+		{
+			Name:         "Unsigned JWT",
+			Header:       "Authorization",
+			Value:        "Bearer eyJhbGciOiJub25lIn0.eyJzdWIiOiJtYWxsb3J5Iiwic2NvcGUiOiJhZG1pbiJ9.",
+			ExpectedCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/register", nil)
+			if tc.Header != "" {
+				req.Header.Set(tc.Header, tc.Value)
+			}
+			rr := httptest.NewRecorder()
+			h(rr, req)
+
+			if rr.Code != tc.ExpectedCode {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedCode, rr.Code)
+			}
+			if tc.ExpectedName != "" && rr.Body.String() != tc.ExpectedName {
+				t.Errorf("expected identity %q, got %q", tc.ExpectedName, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+
+	keys, err := parseJWKS([]byte(`{"keys": [{"kid": "a", "kty": "RSA", "n": "` + n + `", "e": "AQAB"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub, ok := keys["a"].(*rsa.PublicKey); !ok || pub.N.Cmp(key.N) != 0 || pub.E != 65537 {
+		t.Errorf("expected the RSA key to be loaded, got %v", keys["a"])
+	}
+
+	tt := []struct {
+		Name     string
+		JWKS     string
+		Expected string
+	}{
+		{Name: "Malformed n", JWKS: `{"keys": [{"kid": "a", "kty": "RSA", "n": "!!", "e": "AQAB"}]}`, Expected: `invalid n for key "a"`},
+		{Name: "Missing e", JWKS: `{"keys": [{"kid": "a", "kty": "RSA", "n": "` + n + `"}]}`, Expected: `missing e for key "a"`},
+		{Name: "Missing y", JWKS: `{"keys": [{"kid": "b", "kty": "EC", "crv": "P-256", "x": "AQAB"}]}`, Expected: `missing y for key "b"`},
+		{Name: "Point off the curve", JWKS: `{"keys": [{"kid": "b", "kty": "EC", "crv": "P-256", "x": "AQAB", "y": "AQAB"}]}`, Expected: "isn't on the P-256 curve"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			if _, err := parseJWKS([]byte(tc.JWKS)); err == nil || !strings.Contains(err.Error(), tc.Expected) {
+				t.Errorf("expected an error containing %q, got %v", tc.Expected, err)
+			}
+		})
+	}
+}
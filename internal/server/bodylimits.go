@@ -0,0 +1,30 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/raphaelreyna/latte/internal/job"
+)
+
+// checkContentLength responds with a 413 status and returns false if the client announced a body larger than allowed,
+// so that it's turned away before any of it is read.
+func (s *Server) checkContentLength(w http.ResponseWriter, r *http.Request) bool {
+	if max := s.reqLimits.MaxBodySize; max > 0 && r.ContentLength > max {
+		s.respondError(w, r, fmt.Sprintf("request body is larger than the limit of %d bytes", max), http.StatusRequestEntityTooLarge)
+		return false
+	}
+	return true
+}
+
+// respondDecodeError responds to err, which occurred while decoding the body of r, with a 413 status if the body
+// exceeded a limit and code otherwise.
+func (s *Server) respondDecodeError(w http.ResponseWriter, r *http.Request, err error, code int) {
+	var le *job.LimitError
+	if errors.As(err, &le) {
+		s.respondError(w, r, le.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	s.respondError(w, r, "error while parsing json body: "+err.Error(), code)
+}
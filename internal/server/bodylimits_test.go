@@ -0,0 +1,63 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/raphaelreyna/latte/internal/job"
+	"github.com/sirupsen/logrus"
+)
+
+func TestServer_RequestLimits(t *testing.T) {
+	root, err := ioutil.TempDir("", "latte-limits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	s := Server{log: logrus.New(), rootDir: root}
+	if s.tmplCache, err = job.NewTemplateCache(1); err != nil {
+		t.Fatal(err)
+	}
+	if err = WithRequestLimits(job.RequestLimits{
+		MaxBodySize:     256,
+		MaxResources:    1,
+		MaxResourceSize: 3,
+		MaxDetailsDepth: 2,
+	})(&s); err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		Name          string
+		Handler       http.HandlerFunc
+		Body          string
+		ContentLength int64
+	}{
+		{Name: "Announced body too large", Handler: s.handleGenerate(), Body: `{}`, ContentLength: 257},
+		{Name: "Body too large", Handler: s.handleGenerate(), Body: `{"details": {"a": "` + strings.Repeat("a", 256) + `"}}`, ContentLength: -1},
+		{Name: "Too many resources", Handler: s.handleGenerate(), Body: `{"resources": {"a.png": "", "b.png": ""}}`},
+		{Name: "Resource too large", Handler: s.handleGenerate(), Body: `{"resources": {"a.png": "cG5ncG5u"}}`},
+		{Name: "Details too deep", Handler: s.handleGenerate(), Body: `{"details": {"a": {"b": {}}}}`},
+		{Name: "Lint body too large", Handler: s.handleLint(), Body: `{"template": "` + strings.Repeat("a", 256) + `"}`, ContentLength: -1},
+		{Name: "Registered file too large", Handler: s.handleRegister(), Body: `{"id": "a.png", "data": "cG5ncG5u"}`},
+		{Name: "Register body too large", Handler: s.handleRegister(), Body: `{"id": "a.png", "data": "` + strings.Repeat("a", 256) + `"}`, ContentLength: -1},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tc.Body))
+			req.Header.Set("Content-Type", "application/json")
+			if tc.ContentLength != 0 {
+				req.ContentLength = tc.ContentLength
+			}
+			rr := httptest.NewRecorder()
+			tc.Handler(rr, req)
+			if rr.Code != http.StatusRequestEntityTooLarge {
+				t.Errorf("expected status 413, got %d: %s", rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
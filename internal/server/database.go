@@ -6,8 +6,11 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/raphaelreyna/go-recon"
+	"github.com/raphaelreyna/latte/internal/job"
+	"github.com/raphaelreyna/latte/internal/metrics"
 )
 
 type DB interface {
@@ -27,6 +30,52 @@ func (nfe *NotFoundError) Error() string {
 	return "blob not found in database"
 }
 
+// instrumentedDB records the latency of each operation performed on the DB it wraps.
+type instrumentedDB struct {
+	DB
+}
+
+func observeDB(op string, start time.Time) {
+	metrics.DBDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+}
+
+func (idb instrumentedDB) Store(ctx context.Context, uid string, i interface{}) error {
+	if err := job.CheckName(uid); err != nil {
+		return err
+	}
+	defer observeDB("store", time.Now())
+	return idb.DB.Store(ctx, uid, i)
+}
+
+func (idb instrumentedDB) Fetch(ctx context.Context, uid string) (interface{}, error) {
+	if err := job.CheckName(uid); err != nil {
+		return nil, err
+	}
+	defer observeDB("fetch", time.Now())
+	return idb.DB.Fetch(ctx, uid)
+}
+
+func (idb instrumentedDB) Ping(ctx context.Context) error {
+	defer observeDB("ping", time.Now())
+	return idb.DB.Ping(ctx)
+}
+
+func (idb instrumentedDB) AddFileAs(name, destination string, perm os.FileMode) error {
+	if err := job.CheckName(name); err != nil {
+		return err
+	}
+	defer observeDB("add_file", time.Now())
+	return idb.DB.AddFileAs(name, destination, perm)
+}
+
+// Close closes the wrapped DB if it can be closed.
+func (idb instrumentedDB) Close() error {
+	if c, ok := idb.DB.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
 // toDisk only accepts argument i of types []byte or io.ReadCloser
 func toDisk(i interface{}, path string) error {
 	switch t := i.(type) {
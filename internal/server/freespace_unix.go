@@ -0,0 +1,14 @@
+// +build !windows
+
+package server
+
+import "syscall"
+
+// freeSpace returns the number of bytes available to unprivileged users on the filesystem holding path.
+func freeSpace(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return st.Bavail * uint64(st.Bsize), nil
+}
@@ -0,0 +1,8 @@
+package server
+
+import "errors"
+
+// freeSpace is not supported on Windows.
+func freeSpace(path string) (uint64, error) {
+	return 0, errors.New("checking free space is not supported on windows")
+}
@@ -1,36 +1,56 @@
 package server
 
 import (
-	"encoding/json"
+	"bytes"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/raphaelreyna/go-recon/sources"
 	"github.com/raphaelreyna/latte/internal/job"
+	"github.com/raphaelreyna/latte/internal/logging"
+	"github.com/raphaelreyna/latte/internal/metrics"
+	"github.com/raphaelreyna/latte/internal/tracing"
+	"github.com/sirupsen/logrus"
 )
 
 func (s *Server) handleGenerate() http.HandlerFunc {
-	type errorResponse struct {
-		Error string `json:"error"`
-		Data  string `json:"data,omitempty"`
-	}
-
 	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context())
+		if !s.checkContentLength(w, r) {
+			log.WithField("content_length", r.ContentLength).Warn("request body too large")
+			return
+		}
+		metrics.JobsQueued.Inc()
+		queued := true
+		defer func() {
+			if queued {
+				metrics.JobsQueued.Dec()
+			}
+		}()
+
 		// Create temporary directory into which we'll copy all of the required resource files
 		// and eventually run pdflatex in.
 		workDir, err := ioutil.TempDir(s.rootDir, "")
 		if err != nil {
-			s.errLog.Println(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			log.WithError(err).Error("error while creating work directory")
+			s.respondError(w, r, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		s.infoLog.Printf("created new temp directory: %s", workDir)
+		log = log.WithField("work_dir", workDir)
+		log.Debug("created new temp directory")
+		s.jobs.Add(1)
 		defer func() {
 			go func() {
+				defer s.jobs.Done()
 				if err = os.RemoveAll(workDir); err != nil {
-					s.errLog.Println(err)
+					log.WithError(err).Error("error while removing work directory")
 				}
 			}()
 		}()
@@ -43,41 +63,157 @@ func (s *Server) handleGenerate() http.HandlerFunc {
 
 		// Grab any data sent as JSON
 		if r.Header.Get("Content-Type") == "application/json" {
-			var req job.Request
 			defer r.Body.Close()
-			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-				s.errLog.Println(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+			_, span := tracing.Tracer().Start(r.Context(), "decode request")
+			req, err := job.DecodeRequest(r.Body, s.reqLimits)
+			if err != nil {
+				tracing.Fail(span, err)
+				span.End()
+				log.WithError(err).Error("error while parsing json body")
+				s.respondDecodeError(w, r, err, http.StatusBadRequest)
 				return
 			}
+			span.End()
 
 			// Grab details if they were provided
+			_, span = tracing.Tracer().Start(r.Context(), "Request.NewJob")
 			if j, err = req.NewJob(workDir, j.SourceChain, s.tmplCache); err != nil {
-				s.errLog.Println(err)
-				http.Error(w, err.Error(), http.StatusBadRequest)
+				tracing.Fail(span, err)
+				span.End()
+				log.WithError(err).Error("error while creating job from request")
+				s.respondError(w, r, err.Error(), http.StatusBadRequest)
 				return
 			}
+			span.End()
 		}
 
 		// Check the url quuery values for a registered template, registered details or resources
 		// as well as for compilation options and modify the Job accordingly.
-		if err = j.ParseQuery(r.URL.Query(), s.tmplCache); err != nil {
-			s.errLog.Println(err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		if err = j.ParseQuery(r.Context(), r.URL.Query(), s.tmplCache); err != nil {
+			log.WithError(err).Error("error while parsing url query")
+			s.respondError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Skip compiling if the client only wants the template filled in
+		if j.Opts.Render != job.RM_Compile {
+			s.respondFilled(w, r, j)
 			return
 		}
 
+		// Wait for our turn to compile
+		if s.queue != nil {
+			_, span := tracing.Tracer().Start(r.Context(), "wait for queue")
+			err = s.queue.acquire(r.Context())
+			span.End()
+			if err != nil {
+				log.WithError(err).Warn("could not queue job")
+				w.Header().Set("Retry-After", "5")
+				s.respondError(w, r, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			defer s.queue.release()
+		}
+
 		// Compile pdf
+		metrics.JobsQueued.Dec()
+		queued = false
 		pdfPath, err := j.Compile(r.Context())
 		if err != nil {
-			er := &errorResponse{Error: err.Error(), Data: string(pdfPath)}
+			er := &errorResponse{Error: err.Error(), Data: string(pdfPath), RequestID: RequestIDFromContext(r.Context())}
 			w.Header().Set("Content-Type", "application/json")
-			s.errLog.Printf("%s", s.respond(w, er, http.StatusInternalServerError))
+			log.WithError(err).WithField("output", pdfPath).Error("error while compiling pdf")
+			s.respond(w, er, http.StatusInternalServerError)
+			return
+		}
+
+		// Images of each page are sent together
+		if j.Opts.Output.Paged() {
+			s.respondPages(w, r, j)
 			return
 		}
 
 		// Send the newly rendered PDF to the client
-		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Type", j.Opts.Output.ContentType())
 		http.ServeFile(w, r, filepath.Join(workDir, pdfPath))
 	}
 }
+
+// respondPages sends the client the image of each page produced by compiling j, as a multipart/mixed response if the
+// client accepts one and as a zip archive otherwise.
+func (s *Server) respondPages(w http.ResponseWriter, r *http.Request, j *job.Job) {
+	log := logging.FromContext(r.Context()).WithFields(logrus.Fields{"output": j.Opts.Output, "pages": len(j.Outputs)})
+	if strings.Contains(r.Header.Get("Accept"), "multipart/mixed") {
+		// Once the first part is written the status can't be changed, so errors can only be logged
+		mw := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+		for i, name := range j.Outputs {
+			hdr := textproto.MIMEHeader{}
+			hdr.Set("Content-Type", j.Opts.Output.ContentType())
+			hdr.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", j.PageName(i)))
+			pw, err := mw.CreatePart(hdr)
+			if err != nil {
+				log.WithError(err).Error("error while writing multipart response")
+				return
+			}
+			if err = copyFileTo(pw, filepath.Join(j.Root, name)); err != nil {
+				log.WithError(err).Error("error while writing multipart response")
+				return
+			}
+		}
+		if err := mw.Close(); err != nil {
+			log.WithError(err).Error("error while writing multipart response")
+		}
+		return
+	}
+
+	s.respondZip(w, r, filepath.Base(j.Root)+".zip", j.WriteOutputsZip)
+}
+
+// respondZip sends the client the zip archive written by write as an attachment named name.
+func (s *Server) respondZip(w http.ResponseWriter, r *http.Request, name string, write func(io.Writer) error) {
+	log := logging.FromContext(r.Context())
+	// Buffer the archive so that the client gets a proper error if zipping fails part way through
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		log.WithError(err).Error("error while zipping")
+		s.respondError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.WithError(err).Error("error while writing zip response")
+	}
+}
+
+// copyFileTo copies the contents of the file at path to w.
+func copyFileTo(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// respondFilled fills in the template for j without compiling it, sending the client either the filled-in tex file
+// or a zip of the work directory depending on the jobs render mode.
+func (s *Server) respondFilled(w http.ResponseWriter, r *http.Request, j *job.Job) {
+	log := logging.FromContext(r.Context()).WithField("render", j.Opts.Render)
+	if err := j.Fill(r.Context()); err != nil {
+		log.WithError(err).Error("error while filling in template")
+		s.respondError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch j.Opts.Render {
+	case job.RM_Tex:
+		w.Header().Set("Content-Type", "application/x-tex")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(j.TexFile)))
+		http.ServeFile(w, r, j.TexFile)
+	case job.RM_Zip:
+		s.respondZip(w, r, filepath.Base(j.Root)+".zip", j.WriteZip)
+	}
+}
@@ -1,20 +1,26 @@
 package server
 
 import (
+	"archive/zip"
 	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"mime"
+	"mime/multipart"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
 	"testing"
+
 	"github.com/raphaelreyna/latte/internal/job"
+	"github.com/sirupsen/logrus"
 )
 
 type mockDB struct {
@@ -99,6 +105,9 @@ func TestHandleGenerate_Basic(t *testing.T) {
 
 		// Count valid values: > 0
 		Count uint
+
+		// Reproducible output is compared exactly
+		Reproducible bool
 	}
 
 	tt := []test{
@@ -131,6 +140,16 @@ func TestHandleGenerate_Basic(t *testing.T) {
 			Expectation:    "hello-world_alice.pdf",
 			ExpectedToPass: true,
 		},
+		test{
+			Name:           "Reproducible",
+			TexFile:        "hello-world.tex",
+			DtlsFile:       "hello-world_alice.json",
+			Resources:      nil,
+			Delimiters:     map[string]string{"left": "#!", "right": "!#"},
+			Reproducible:   true,
+			Expectation:    "hello-world_alice.pdf",
+			ExpectedToPass: true,
+		},
 		test{
 			Name:            "Registered tex file",
 			TexFile:         "hello-world.tex",
@@ -193,7 +212,7 @@ func TestHandleGenerate_Basic(t *testing.T) {
 	}
 	defer func() {
 		os.Chdir("../")
-		// os.RemoveAll(testingDir)
+		os.RemoveAll(testingDir)
 	}()
 
 	for _, tc := range tt {
@@ -204,10 +223,9 @@ func TestHandleGenerate_Basic(t *testing.T) {
 				t.Fatalf("error getting working directory: %s", err.Error())
 			}
 			s := Server{
-				cmd:        "pdflatex",
-				errLog:     log.New(log.Writer(), tc.Name+" Error: ", log.LstdFlags),
-				infoLog:    log.New(ioutil.Discard, "", log.LstdFlags),
-				rootDir:    here,
+				cmd:     "pdflatex",
+				log:     logrus.WithField("test", tc.Name),
+				rootDir: here,
 			}
 
 			s.tmplCache, err = job.NewTemplateCache(1)
@@ -241,11 +259,13 @@ func TestHandleGenerate_Basic(t *testing.T) {
 				OnMissingKey string                 `json:"onMissingKey, omitempty"`
 				Count        uint                   `json:"count, omitempty"`
 				Compiler     string                 `json:"compiler, omitempty"`
+				Reproducible bool                   `json:"reproducible,omitempty"`
 			}{
 				Delimiters:   tc.Delimiters,
 				OnMissingKey: tc.OnMissingKey,
 				Count:        tc.Count,
 				Compiler:     tc.Compiler,
+				Reproducible: tc.Reproducible,
 			}
 
 			// Handle Tex file
@@ -367,24 +387,15 @@ func TestHandleGenerate_Basic(t *testing.T) {
 			if err != nil {
 				t.Fatalf("error while creating request payload: %+v", err)
 			}
-			req := httptest.NewRequest("GET", "/generate", bytes.NewBuffer(testPayload))
-			req.Header.Set("Content-Type", "application/json")
-			req.URL.RawQuery = q.Encode()
-			rr := httptest.NewRecorder()
-
-			// Create the HTTP handler to be tested and save current working directory to move back into
-			// after handler being tested is called; this is necessary since the handler changes the current working directory.
-			wd, err := os.Getwd()
-			if err != nil {
-				t.Fatalf("error while grabbing current directory: %+v", err)
-			}
-			os.Chdir("../")
-			s.handleGenerate()(rr, req)
-			err = os.Chdir(wd)
-			if err != nil {
-				t.Fatalf("error while moving back into testing directory")
+			generate := func() *httptest.ResponseRecorder {
+				req := httptest.NewRequest("GET", "/generate", bytes.NewBuffer(testPayload))
+				req.Header.Set("Content-Type", "application/json")
+				req.URL.RawQuery = q.Encode()
+				rr := httptest.NewRecorder()
+				s.handleGenerate()(rr, req)
+				return rr
 			}
-			response := rr.Result()
+			response := generate().Result()
 			if response.StatusCode != 200 && tc.ExpectedToPass {
 				responseBody, err := ioutil.ReadAll(response.Body)
 				response.Body.Close()
@@ -406,6 +417,19 @@ func TestHandleGenerate_Basic(t *testing.T) {
 					t.Fatalf("error while reading received PDF: %+v", err)
 				}
 				response.Body.Close()
+
+				// The exact bytes depend on the TeX installation, so reproducible output is held to a second compile of
+				// the same request rather than to the expected PDF
+				if tc.Reproducible {
+					again := generate()
+					if again.Code != 200 {
+						t.Fatalf("got non 200 status when compiling again: %d: %s", again.Code, again.Body.String())
+					}
+					if !bytes.Equal(receivedPDF, again.Body.Bytes()) {
+						t.Error("expected reproducible request to produce byte-identical PDFs")
+					}
+					return
+				}
 				receivedPDF64 := base64.StdEncoding.EncodeToString(receivedPDF)
 
 				// Since PDFs seem to have some 'wiggle' to them, we have to make do with checking if our PDFs are 'close enough'
@@ -421,6 +445,164 @@ func TestHandleGenerate_Basic(t *testing.T) {
 	}
 }
 
+// TestHandleGenerate_Render tests that render only requests respond with the filled-in template instead of a PDF.
+func TestHandleGenerate_Render(t *testing.T) {
+	root, err := ioutil.TempDir("", "latte-root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	s := Server{log: logrus.New(), rootDir: root}
+	if s.tmplCache, err = job.NewTemplateCache(1); err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		Name               string
+		Render             string
+		ExpectedStatusCode int
+		ExpectedType       string
+	}{
+		{Name: "Tex", Render: "tex", ExpectedStatusCode: 200, ExpectedType: "application/x-tex"},
+		{Name: "Zip", Render: "zip", ExpectedStatusCode: 200, ExpectedType: "application/zip"},
+		{Name: "Invalid", Render: "docx", ExpectedStatusCode: 400, ExpectedType: "application/json"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			payload, err := json.Marshal(&job.Request{
+				Template:  base64.StdEncoding.EncodeToString([]byte("Hello #!.name!#")),
+				Details:   map[string]interface{}{"name": "Alice"},
+				Resources: map[string]string{"logo.png": base64.StdEncoding.EncodeToString([]byte("png"))},
+				Render:    job.RenderMode(tc.Render),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("POST", "/generate", bytes.NewReader(payload))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			s.handleGenerate()(rr, req)
+
+			if rr.Code != tc.ExpectedStatusCode {
+				t.Fatalf("expected status %d, got %d: %s", tc.ExpectedStatusCode, rr.Code, rr.Body.String())
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != tc.ExpectedType {
+				t.Fatalf("expected content type %s, got %s", tc.ExpectedType, ct)
+			}
+
+			switch tc.Render {
+			case "tex":
+				if body := rr.Body.String(); body != "Hello Alice" {
+					t.Errorf("expected filled-in template %q, got %q", "Hello Alice", body)
+				}
+			case "zip":
+				zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(zr.File) != 2 {
+					t.Errorf("expected the filled-in template and resource in the zip, got %d files", len(zr.File))
+				}
+			}
+		})
+	}
+}
+
+// TestHandleGenerate_BadJSON tests that malformed request bodies are the clients fault.
+func TestHandleGenerate_BadJSON(t *testing.T) {
+	root, err := ioutil.TempDir("", "latte-root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	s := Server{log: logrus.New(), rootDir: root}
+	if s.tmplCache, err = job.NewTemplateCache(1); err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		Name string
+		Body string
+	}{
+		{Name: "Malformed", Body: `{"template": `},
+		{Name: "Wrong type", Body: `{"count": "two"}`},
+		{Name: "Resources not an object", Body: `{"resources": ["a.png"]}`},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/generate", bytes.NewReader([]byte(tc.Body)))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			s.handleGenerate()(rr, req)
+			if rr.Code != 400 {
+				t.Errorf("expected status 400, got %d: %s", rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestServer_respondPages(t *testing.T) {
+	root, err := ioutil.TempDir("", "latte-job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	j := job.NewJob(root, nil)
+	j.Opts.Output = job.OF_SVG
+	for _, name := range []string{"job-1.svg", "job-2.svg"} {
+		if err = ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		j.Outputs = append(j.Outputs, name)
+	}
+	s := Server{log: logrus.New()}
+
+	t.Run("Zip", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.respondPages(rr, httptest.NewRequest("POST", "/generate", nil), j)
+		if ct := rr.Header().Get("Content-Type"); ct != "application/zip" {
+			t.Fatalf("expected content type application/zip, got %s", ct)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(zr.File) != 2 || zr.File[0].Name != "page-1.svg" || zr.File[1].Name != "page-2.svg" {
+			t.Errorf("expected page-1.svg and page-2.svg in the zip, got %d files", len(zr.File))
+		}
+	})
+
+	t.Run("Multipart", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/generate", nil)
+		req.Header.Set("Accept", "multipart/mixed")
+		rr := httptest.NewRecorder()
+		s.respondPages(rr, req, j)
+		mt, params, err := mime.ParseMediaType(rr.Header().Get("Content-Type"))
+		if err != nil || mt != "multipart/mixed" {
+			t.Fatalf("expected a multipart/mixed response, got %q", rr.Header().Get("Content-Type"))
+		}
+		mr := multipart.NewReader(rr.Body, params["boundary"])
+		for i, name := range j.Outputs {
+			p, err := mr.NextPart()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ct := p.Header.Get("Content-Type"); ct != "image/svg+xml" {
+				t.Errorf("expected part content type image/svg+xml, got %s", ct)
+			}
+			if fn := p.FileName(); fn != j.PageName(i) {
+				t.Errorf("expected part file name %s, got %s", j.PageName(i), fn)
+			}
+			if data, _ := ioutil.ReadAll(p); string(data) != name {
+				t.Errorf("expected part to contain %q, got %q", name, data)
+			}
+		}
+		if _, err = mr.NextPart(); err != io.EOF {
+			t.Errorf("expected exactly %d parts, got error %v", len(j.Outputs), err)
+		}
+	})
+}
+
 func GetContentsBase64(path string) (string, error) {
 	f, err := os.Open(path)
 	defer f.Close()
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/raphaelreyna/latte/internal/job"
+	"github.com/raphaelreyna/latte/internal/logging"
+)
+
+// healthCheckTimeout bounds how long any single dependency check may take.
+const healthCheckTimeout = 2 * time.Second
+
+type checkResult struct {
+	Status string      `json:"status"`
+	Error  string      `json:"error,omitempty"`
+	Info   interface{} `json:"info,omitempty"`
+}
+
+type healthResponse struct {
+	Status string                  `json:"status"`
+	Checks map[string]*checkResult `json:"checks"`
+}
+
+type healthCheck func(ctx context.Context) (interface{}, error)
+
+// handleHealth responds with the outcome of each check, failing with a 503 status if any of them fail.
+func (s *Server) handleHealth(checks map[string]healthCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		defer cancel()
+
+		resp := &healthResponse{Status: "ok", Checks: map[string]*checkResult{}}
+		code := http.StatusOK
+		for name, check := range checks {
+			info, err := check(ctx)
+			result := &checkResult{Status: "ok", Info: info}
+			if err != nil {
+				result.Status = "fail"
+				result.Error = err.Error()
+				resp.Status = "fail"
+				code = http.StatusServiceUnavailable
+				logging.FromContext(r.Context()).WithError(err).WithField("check", name).Warn("health check failed")
+			}
+			resp.Checks[name] = result
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		s.respond(w, resp, code)
+	}
+}
+
+// livenessChecks returns the checks which, if failing, mean this instance can not recover on its own.
+func (s *Server) livenessChecks() map[string]healthCheck {
+	return map[string]healthCheck{
+		"root":     s.checkRootWritable,
+		"compiler": s.checkCompiler,
+	}
+}
+
+// readinessChecks returns the checks which must pass for this instance to be sent new jobs.
+func (s *Server) readinessChecks() map[string]healthCheck {
+	return map[string]healthCheck{
+		"db":        s.checkDB,
+		"root":      s.checkRootWritable,
+		"diskSpace": s.checkDiskSpace,
+		"compiler":  s.checkCompiler,
+		"queue":     s.checkQueue,
+	}
+}
+
+func (s *Server) checkDB(ctx context.Context) (interface{}, error) {
+	if s.db == nil {
+		return "no database configured", nil
+	}
+	return nil, s.db.Ping(ctx)
+}
+
+func (s *Server) checkRootWritable(ctx context.Context) (interface{}, error) {
+	f, err := ioutil.TempFile(s.rootDir, ".healthcheck-*")
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return nil, os.Remove(f.Name())
+}
+
+func (s *Server) checkDiskSpace(ctx context.Context) (interface{}, error) {
+	free, err := freeSpace(s.rootDir)
+	if err != nil {
+		return nil, err
+	}
+	info := map[string]uint64{"freeBytes": free, "minFreeBytes": s.minFreeSpace}
+	if free < s.minFreeSpace {
+		return info, fmt.Errorf("only %d bytes free in %s", free, s.rootDir)
+	}
+	return info, nil
+}
+
+func (s *Server) checkCompiler(ctx context.Context) (interface{}, error) {
+	info := map[string]string{}
+	for _, cmd := range []string{s.cmd, string(job.CC_Default)} {
+		if cmd == "" {
+			continue
+		}
+		path, err := exec.LookPath(cmd)
+		if err != nil {
+			return info, err
+		}
+		info[cmd] = path
+	}
+	return info, nil
+}
+
+func (s *Server) checkQueue(ctx context.Context) (interface{}, error) {
+	if s.queue == nil {
+		return "unbounded", nil
+	}
+	info := map[string]int{
+		"active":    s.queue.active(),
+		"maxActive": cap(s.queue.slots),
+		"queued":    s.queue.queued(),
+		"maxQueued": int(s.queue.maxQueued),
+	}
+	if s.queue.saturated() {
+		return info, errQueueFull
+	}
+	return info, nil
+}
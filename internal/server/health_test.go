@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/raphaelreyna/latte/internal/logging"
+)
+
+type downDB struct {
+	mockDB
+}
+
+func (ddb *downDB) Ping(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestServer_Health(t *testing.T) {
+	root, err := ioutil.TempDir("", "latte-health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	tt := []struct {
+		Name         string
+		Path         string
+		Server       *Server
+		ExpectedCode int
+		FailedChecks []string
+	}{
+		{
+			Name:         "Live",
+			Path:         "/healthz",
+			Server:       &Server{rootDir: root, db: &downDB{}},
+			ExpectedCode: http.StatusOK,
+		},
+		{
+			Name:         "Database down",
+			Path:         "/readyz",
+			Server:       &Server{rootDir: root, db: &downDB{}},
+			ExpectedCode: http.StatusServiceUnavailable,
+			FailedChecks: []string{"db"},
+		},
+		{
+			Name:         "Root directory missing",
+			Path:         "/healthz",
+			Server:       &Server{rootDir: root + "/missing"},
+			ExpectedCode: http.StatusServiceUnavailable,
+			FailedChecks: []string{"root"},
+		},
+		{
+			Name:         "Disk full",
+			Path:         "/readyz",
+			Server:       &Server{rootDir: root, minFreeSpace: 1 << 62},
+			ExpectedCode: http.StatusServiceUnavailable,
+			FailedChecks: []string{"diskSpace"},
+		},
+		{
+			Name:         "Queue saturated",
+			Path:         "/readyz",
+			Server:       &Server{rootDir: root, queue: &jobQueue{waiting: 2, maxQueued: 2, slots: make(chan struct{}, 1)}},
+			ExpectedCode: http.StatusServiceUnavailable,
+			FailedChecks: []string{"queue"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := tc.Server
+			s.log = logging.Discard()
+			checks := s.livenessChecks()
+			if tc.Path == "/readyz" {
+				checks = s.readinessChecks()
+			}
+			// TeX isn't necessarily installed wherever the tests are run
+			delete(checks, "compiler")
+
+			rr := httptest.NewRecorder()
+			s.handleHealth(checks)(rr, httptest.NewRequest("GET", tc.Path, nil))
+			if rr.Code != tc.ExpectedCode {
+				t.Fatalf("expected status %d, got %d: %s", tc.ExpectedCode, rr.Code, rr.Body.String())
+			}
+
+			var resp healthResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range tc.FailedChecks {
+				if c := resp.Checks[name]; c == nil || c.Status != "fail" {
+					t.Errorf("expected check %s to fail, got %+v", name, c)
+				}
+			}
+		})
+	}
+}
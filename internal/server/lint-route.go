@@ -0,0 +1,42 @@
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+
+	"github.com/raphaelreyna/latte/internal/job"
+	"github.com/raphaelreyna/latte/internal/logging"
+)
+
+func (s *Server) handleLint() http.HandlerFunc {
+	type response struct {
+		Issues []job.LintIssue `json:"issues"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context())
+		if !s.checkContentLength(w, r) {
+			return
+		}
+		req, err := job.DecodeRequest(r.Body, s.reqLimits)
+		if err != nil {
+			log.WithError(err).Error("error while parsing json body")
+			s.respondDecodeError(w, r, err, http.StatusBadRequest)
+			return
+		}
+		r.Body.Close()
+
+		tmpl, err := base64.StdEncoding.DecodeString(req.Template)
+		if err != nil {
+			log.WithError(err).Error("error while decoding template")
+			s.respondError(w, r, "error while decoding template: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Lint with the same delimiters /generate would fill the template in with
+		issues := job.Lint("template", string(tmpl), req.Delimiters.OrDefault())
+		if issues == nil {
+			issues = []job.LintIssue{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		s.respond(w, &response{Issues: issues}, http.StatusOK)
+	}
+}
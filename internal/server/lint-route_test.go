@@ -0,0 +1,75 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/raphaelreyna/latte/internal/job"
+	"github.com/sirupsen/logrus"
+)
+
+func TestHandleLint(t *testing.T) {
+	s := Server{log: logrus.New()}
+
+	tt := []struct {
+		Name               string
+		Body               string
+		ExpectedStatusCode int
+		ExpectedIssues     int
+	}{
+		{
+			Name:               "Clean",
+			Body:               `{"template":"` + base64.StdEncoding.EncodeToString([]byte(`\textbf{#!.Name | texEscape!#}`)) + `"}`,
+			ExpectedStatusCode: 200,
+		},
+		{
+			Name:               "Problems",
+			Body:               `{"template":"` + base64.StdEncoding.EncodeToString([]byte(`\textbf{#!.Name!#`)) + `"}`,
+			ExpectedStatusCode: 200,
+			ExpectedIssues:     2,
+		},
+		{
+			Name:               "Custom delimiters",
+			Body:               `{"template":"` + base64.StdEncoding.EncodeToString([]byte(`<<upper .Name>>`)) + `","delimiters":{"Left":"<<","Right":">>"}}`,
+			ExpectedStatusCode: 200,
+			ExpectedIssues:     1,
+		},
+		{
+			Name:               "Go template delimiters",
+			Body:               `{"template":"` + base64.StdEncoding.EncodeToString([]byte(`\textbf{#!.Name | texEscape!#}`)) + `","delimiters":{"Left":"{{","Right":"}}"}}`,
+			ExpectedStatusCode: 200,
+		},
+		{
+			Name:               "Bad template encoding",
+			Body:               `{"template":"not base64!"}`,
+			ExpectedStatusCode: 400,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/lint", bytes.NewBufferString(tc.Body))
+			rr := httptest.NewRecorder()
+			s.handleLint()(rr, req)
+
+			if rr.Code != tc.ExpectedStatusCode {
+				t.Fatalf("expected status %d, got %d: %s", tc.ExpectedStatusCode, rr.Code, rr.Body.String())
+			}
+			if rr.Code != 200 {
+				return
+			}
+			var resp struct {
+				Issues []job.LintIssue `json:"issues"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Issues == nil || len(resp.Issues) != tc.ExpectedIssues {
+				t.Errorf("expected %d issues, got %+v", tc.ExpectedIssues, resp.Issues)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// errQueueFull is returned when a job can not be queued because too many jobs are already waiting to compile.
+var errQueueFull = errors.New("too many jobs waiting to compile")
+
+// jobQueue bounds the number of jobs compiling at once, making the rest wait their turn.
+type jobQueue struct {
+	// 64-bit fields come first to keep them aligned for atomic operations
+	waiting   int64
+	maxQueued int64
+	slots     chan struct{}
+}
+
+func newJobQueue(maxActive, maxQueued int) *jobQueue {
+	return &jobQueue{
+		slots:     make(chan struct{}, maxActive),
+		maxQueued: int64(maxQueued),
+	}
+}
+
+// acquire blocks until a job may start compiling.
+// errQueueFull is returned immediately if the queue is saturated.
+func (q *jobQueue) acquire(ctx context.Context) error {
+	if atomic.AddInt64(&q.waiting, 1) > q.maxQueued && q.maxQueued > 0 {
+		atomic.AddInt64(&q.waiting, -1)
+		return errQueueFull
+	}
+	defer atomic.AddInt64(&q.waiting, -1)
+
+	select {
+	case q.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees up the slot taken by a call to acquire.
+func (q *jobQueue) release() {
+	<-q.slots
+}
+
+// active returns the number of jobs currently compiling.
+func (q *jobQueue) active() int {
+	return len(q.slots)
+}
+
+// queued returns the number of jobs waiting to compile.
+func (q *jobQueue) queued() int {
+	return int(atomic.LoadInt64(&q.waiting))
+}
+
+// saturated reports whether new jobs would be turned away.
+func (q *jobQueue) saturated() bool {
+	return q.maxQueued > 0 && atomic.LoadInt64(&q.waiting) >= q.maxQueued
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/raphaelreyna/latte/internal/logging"
+)
+
+// Limits holds the per client rate limits and daily quotas enforced by the server.
+// Clients are identified by the name of their Identity if they authenticated, and by their IP address otherwise.
+type Limits struct {
+	// Rate is the number of requests per second a client may sustain; zero disables rate limiting.
+	Rate float64
+	// Burst is the number of requests a client may make at once; defaults to 1 if Rate is set.
+	Burst int
+	// DailyCompiles is the number of PDFs a client may generate each day; zero means unlimited.
+	DailyCompiles int
+	// DailyStorage is the number of bytes a client may register each day; zero means unlimited.
+	DailyStorage int64
+}
+
+// limitedClient tracks a single clients token bucket and daily usage.
+type limitedClient struct {
+	tokens   float64
+	last     time.Time
+	day      time.Time
+	compiles int
+	stored   int64
+}
+
+// limiter enforces Limits for every client seen by the server.
+type limiter struct {
+	sync.Mutex
+	Limits
+	clients   map[string]*limitedClient
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// sweepInterval controls how often idle clients are forgotten.
+const sweepInterval = 10 * time.Minute
+
+func newLimiter(l Limits) *limiter {
+	if l.Rate > 0 && l.Burst < 1 {
+		l.Burst = 1
+	}
+	return &limiter{
+		Limits:  l,
+		clients: map[string]*limitedClient{},
+		now:     time.Now,
+	}
+}
+
+// client returns the state for client key, refilling its bucket and resetting its daily usage as needed.
+// The caller must hold the lock.
+func (l *limiter) client(key string) *limitedClient {
+	now := l.now()
+	today := now.UTC().Truncate(24 * time.Hour)
+
+	if now.Sub(l.lastSweep) > sweepInterval {
+		l.sweep(now, today)
+	}
+
+	c, exists := l.clients[key]
+	if !exists {
+		c = &limitedClient{tokens: float64(l.Burst), last: now, day: today}
+		l.clients[key] = c
+	}
+
+	c.tokens = math.Min(float64(l.Burst), c.tokens+now.Sub(c.last).Seconds()*l.Rate)
+	c.last = now
+	if c.day.Before(today) {
+		c.day = today
+		c.compiles = 0
+		c.stored = 0
+	}
+	return c
+}
+
+// sweep forgets clients whose buckets are full and that have no usage today.
+func (l *limiter) sweep(now, today time.Time) {
+	for key, c := range l.clients {
+		full := c.tokens+now.Sub(c.last).Seconds()*l.Rate >= float64(l.Burst)
+		if full && c.day.Before(today) {
+			delete(l.clients, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// untilTomorrow returns the time left before daily quotas reset.
+func (l *limiter) untilTomorrow() time.Duration {
+	now := l.now().UTC()
+	return now.Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now)
+}
+
+// allow takes a token from the bucket of client key, and a compile from its daily quota if compile is true.
+// The RateLimit-* headers are set on w; if the request is not allowed a non-zero Retry-After duration is returned.
+func (l *limiter) allow(w http.ResponseWriter, key string, compile bool) time.Duration {
+	l.Lock()
+	defer l.Unlock()
+	c := l.client(key)
+
+	if compile && l.DailyCompiles > 0 && c.compiles >= l.DailyCompiles {
+		wait := l.untilTomorrow()
+		setHeaders(w, l.DailyCompiles, 0, wait)
+		return wait
+	}
+
+	if l.Rate > 0 {
+		if c.tokens < 1 {
+			wait := time.Duration((1 - c.tokens) / l.Rate * float64(time.Second))
+			setHeaders(w, l.Burst, int(c.tokens), wait)
+			return wait
+		}
+		c.tokens--
+		setHeaders(w, l.Burst, int(c.tokens), time.Duration((float64(l.Burst)-c.tokens)/l.Rate*float64(time.Second)))
+	}
+
+	if compile {
+		c.compiles++
+	}
+	return 0
+}
+
+// allowStorage adds n bytes to the daily storage used by client key, returning a non-zero Retry-After duration if that
+// would exceed its quota, in which case the RateLimit-* headers are set on w.
+// The bytes are counted before they're stored so that concurrent requests can't exceed the quota together; if storing
+// them fails they should be given back with refundStorage.
+func (l *limiter) allowStorage(w http.ResponseWriter, key string, n int64) time.Duration {
+	l.Lock()
+	defer l.Unlock()
+	c := l.client(key)
+
+	if l.DailyStorage > 0 && c.stored+n > l.DailyStorage {
+		wait := l.untilTomorrow()
+		setHeaders(w, int(l.DailyStorage), int(l.DailyStorage-c.stored), wait)
+		return wait
+	}
+	c.stored += n
+	return 0
+}
+
+// refundStorage gives n bytes, which couldn't be stored after all, back to the daily storage quota of client key.
+func (l *limiter) refundStorage(key string, n int64) {
+	l.Lock()
+	defer l.Unlock()
+	if c := l.client(key); c.stored >= n {
+		c.stored -= n
+	}
+}
+
+// setHeaders sets the RateLimit-* headers on w for a client with remaining of limit requests, or bytes, left until
+// reset.
+func setHeaders(w http.ResponseWriter, limit, remaining int, reset time.Duration) {
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(reset.Seconds()))))
+}
+
+// clientKey identifies the client that sent r for rate limiting purposes.
+func clientKey(r *http.Request) string {
+	if id := IdentityFromContext(r.Context()); id != nil && id.Name != "" {
+		return "id:" + id.Name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// tooManyRequests responds with a 429 status, asking the client to retry after wait.
+func (s *Server) tooManyRequests(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	s.respondError(w, r, "too many requests", http.StatusTooManyRequests)
+}
+
+// rateLimit wraps h so that it only runs for clients within their limits.
+// If compile is true, each request counts against the clients daily compile quota.
+func (s *Server) rateLimit(compile bool, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.limiter == nil {
+			h(w, r)
+			return
+		}
+		if wait := s.limiter.allow(w, clientKey(r), compile); wait > 0 {
+			logging.FromContext(r.Context()).WithField("client", clientKey(r)).Warn("rate limited client")
+			s.tooManyRequests(w, r, wait)
+			return
+		}
+		h(w, r)
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	l := newLimiter(Limits{Rate: 1, Burst: 2, DailyCompiles: 3})
+	l.now = func() time.Time { return now }
+
+	allow := func(key string) (time.Duration, *httptest.ResponseRecorder) {
+		rr := httptest.NewRecorder()
+		return l.allow(rr, key, true), rr
+	}
+
+	// The burst is available immediately
+	for i := 0; i < 2; i++ {
+		if wait, _ := allow("alice"); wait != 0 {
+			t.Fatalf("request %d: expected to be allowed, got wait of %s", i, wait)
+		}
+	}
+	wait, rr := allow("alice")
+	if wait != time.Second {
+		t.Fatalf("expected to wait 1s once bucket is empty, got %s", wait)
+	}
+	if rem := rr.Header().Get("RateLimit-Remaining"); rem != "0" {
+		t.Errorf("expected RateLimit-Remaining of 0, got %q", rem)
+	}
+
+	// Other clients have their own buckets
+	if wait, _ := allow("bob"); wait != 0 {
+		t.Fatalf("expected bob to be allowed, got wait of %s", wait)
+	}
+
+	// The bucket refills with time, but the daily compile quota still applies
+	now = now.Add(time.Second)
+	if wait, _ := allow("alice"); wait != 0 {
+		t.Fatalf("expected refilled bucket to allow request, got wait of %s", wait)
+	}
+	now = now.Add(time.Minute)
+	wait, rr = allow("alice")
+	if wait != 11*time.Hour+59*time.Minute-time.Second {
+		t.Fatalf("expected to wait until tomorrow once quota is used, got %s", wait)
+	}
+	if lim, rem := rr.Header().Get("RateLimit-Limit"), rr.Header().Get("RateLimit-Remaining"); lim != "3" || rem != "0" {
+		t.Errorf("expected RateLimit-Limit of 3 and RateLimit-Remaining of 0 once quota is used, got %q and %q", lim, rem)
+	}
+
+	// Quotas reset the next day
+	now = now.Add(12 * time.Hour)
+	if wait, _ := allow("alice"); wait != 0 {
+		t.Fatalf("expected quota to reset, got wait of %s", wait)
+	}
+}
+
+func TestLimiter_AllowStorage(t *testing.T) {
+	l := newLimiter(Limits{DailyStorage: 100})
+	rr := httptest.NewRecorder()
+
+	if wait := l.allowStorage(rr, "alice", 60); wait != 0 {
+		t.Fatalf("expected to be allowed, got wait of %s", wait)
+	}
+	if wait := l.allowStorage(rr, "alice", 60); wait == 0 {
+		t.Fatal("expected storage quota to be exceeded")
+	}
+	if lim, rem := rr.Header().Get("RateLimit-Limit"), rr.Header().Get("RateLimit-Remaining"); lim != "100" || rem != "40" {
+		t.Errorf("expected RateLimit-Limit of 100 and RateLimit-Remaining of 40, got %q and %q", lim, rem)
+	}
+
+	// Bytes that couldn't be stored don't count against the quota
+	l.refundStorage("alice", 60)
+	if wait := l.allowStorage(rr, "alice", 100); wait != 0 {
+		t.Fatalf("expected refunded quota to be usable, got wait of %s", wait)
+	}
+}
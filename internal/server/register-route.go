@@ -3,10 +3,13 @@ package server
 import (
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
-	"path/filepath"
+
+	"github.com/raphaelreyna/latte/internal/job"
+	"github.com/raphaelreyna/latte/internal/logging"
 )
 
 func (s *Server) handleRegister() http.HandlerFunc {
@@ -20,15 +23,30 @@ func (s *Server) handleRegister() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req request
 		var err error
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			msg := "error while parsing json body: " + err.Error()
-			s.errLog.Println(msg)
-			s.respond(w, msg, http.StatusInternalServerError)
+		log := logging.FromContext(r.Context())
+		if !s.checkContentLength(w, r) {
+			log.WithField("content_length", r.ContentLength).Warn("request body too large")
+			return
+		}
+		if err := json.NewDecoder(job.LimitReader(r.Body, s.reqLimits.MaxBodySize)).Decode(&req); err != nil {
+			log.WithError(err).Error("error while parsing json body")
+			s.respondDecodeError(w, r, err, http.StatusInternalServerError)
 			return
 		}
 		r.Body.Close()
+		if max := s.reqLimits.MaxResourceSize; max > 0 && job.Base64Size(req.Data) > max {
+			log.Warn("file too large")
+			s.respondError(w, r, fmt.Sprintf("file is larger than the limit of %d bytes", max), http.StatusRequestEntityTooLarge)
+			return
+		}
+		log = log.WithField("id", req.ID)
 
-		fpath := filepath.Join(s.rootDir, req.ID)
+		fpath, err := job.JoinName(s.rootDir, req.ID)
+		if err != nil {
+			log.WithError(err).Warn("refusing to register file with invalid ID")
+			s.respondError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
 		if _, err = os.Stat(fpath); err == nil {
 			w.Header().Set("Content-Type", "application/json")
 			s.respond(w, &response{ID: req.ID}, http.StatusConflict)
@@ -43,17 +61,17 @@ func (s *Server) handleRegister() http.HandlerFunc {
 					break
 				default:
 					if err != nil {
-						s.errLog.Println(err)
-						s.respond(w, err.Error(), http.StatusInternalServerError)
+						log.WithError(err).Error("error while fetching file from database")
+						s.respondError(w, r, err.Error(), http.StatusInternalServerError)
 						return
 					} else if datai != nil {
 						go func() {
 							err = toDisk(datai, fpath)
 							if err != nil {
-								s.errLog.Printf("error while creating file at %s: %v", fpath, err)
+								log.WithError(err).Errorf("error while creating file at %s", fpath)
 								return
 							}
-							s.infoLog.Printf("saved file from database to local disk: %s", req.ID)
+							log.Info("saved file from database to local disk")
 						}()
 						w.Header().Set("Content-Type", "application/json")
 						s.respond(w, &response{ID: req.ID}, http.StatusConflict)
@@ -64,28 +82,39 @@ func (s *Server) handleRegister() http.HandlerFunc {
 			// File doesn't exist locally (or in db)
 			bytes, err := base64.StdEncoding.DecodeString(req.Data)
 			if err != nil {
-				s.errLog.Println(err)
-				s.respond(w, err.Error(), http.StatusInternalServerError)
+				log.WithError(err).Error("error while decoding file")
+				s.respondError(w, r, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			if s.limiter != nil {
+				if wait := s.limiter.allowStorage(w, clientKey(r), int64(len(bytes))); wait > 0 {
+					log.WithField("client", clientKey(r)).Warn("client exceeded its daily storage quota")
+					s.tooManyRequests(w, r, wait)
+					return
+				}
+			}
 			if err = ioutil.WriteFile(fpath, bytes, os.ModePerm); err != nil {
-				s.errLog.Println(err)
-				s.respond(w, err.Error(), http.StatusInternalServerError)
+				// Nothing was stored so it shouldn't count against the clients quota
+				if s.limiter != nil {
+					s.limiter.refundStorage(clientKey(r), int64(len(bytes)))
+				}
+				log.WithError(err).Error("error while writing file to local disk")
+				s.respondError(w, r, err.Error(), http.StatusInternalServerError)
 				return
 			}
-			s.infoLog.Printf("wrote new file to local disk: %s", req.ID)
+			log.Info("wrote new file to local disk")
 			if s.db != nil {
 				if err = s.db.Store(r.Context(), req.ID, bytes); err != nil {
-					s.errLog.Println(err)
-					s.respond(w, err.Error(), http.StatusInternalServerError)
+					log.WithError(err).Error("error while storing file in database")
+					s.respondError(w, r, err.Error(), http.StatusInternalServerError)
 					return
 				}
-				s.infoLog.Printf("sent new file to database; successfully completed registration: %s", req.ID)
+				log.Info("sent new file to database; successfully completed registration")
 			}
 			w.Header().Set("Content-Type", "application/json")
 			s.respond(w, &response{ID: req.ID}, http.StatusOK)
 			return
 		}
-		s.respond(w, err.Error(), http.StatusInternalServerError)
+		s.respondError(w, r, err.Error(), http.StatusInternalServerError)
 	}
 }
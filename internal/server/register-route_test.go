@@ -0,0 +1,62 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestHandleRegister_InvalidIDs(t *testing.T) {
+	parent, err := ioutil.TempDir("", "latte-register")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(parent)
+	root := filepath.Join(parent, "root")
+	if err = os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	s := Server{log: logrus.New(), rootDir: root}
+
+	for _, id := range []string{"", "..", "../escaped", "../../etc/x", "/etc/x", `..\escaped`, "a/b", ".latexmkrc", "-x", "x\x00y"} {
+		body, _ := json.Marshal(map[string]string{"id": id, "data": "cHduZWQ="})
+		rr := httptest.NewRecorder()
+		s.handleRegister()(rr, httptest.NewRequest("POST", "/register", bytes.NewReader(body)))
+		if rr.Code != 400 {
+			t.Errorf("expected 400 registering %q, got %d: %s", id, rr.Code, rr.Body.String())
+		}
+	}
+
+	for _, dir := range []string{parent, root} {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (dir == parent && len(infos) != 1) || (dir == root && len(infos) != 0) {
+			t.Errorf("expected nothing to be written to %s, found %d entries", dir, len(infos))
+		}
+	}
+
+	// The database refuses invalid IDs even if the handler is bypassed
+	db := instrumentedDB{&mockDB{map[string]interface{}{}}}
+	if err = db.Store(context.Background(), "../escaped", []byte("x")); err == nil {
+		t.Error("expected the database to refuse an invalid ID")
+	}
+	if err = db.AddFileAs("../escaped", filepath.Join(root, "../escaped"), 0644); err == nil {
+		t.Error("expected the database to refuse an invalid name")
+	}
+
+	body, _ := json.Marshal(map[string]string{"id": "logo.png", "data": "cG5n"})
+	rr := httptest.NewRecorder()
+	s.handleRegister()(rr, httptest.NewRequest("POST", "/register", bytes.NewReader(body)))
+	if rr.Code != 200 {
+		t.Errorf("expected 200 registering a valid ID, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
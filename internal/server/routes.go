@@ -2,19 +2,62 @@ package server
 
 import (
 	"net/http"
+	"strconv"
 
+	"github.com/felixge/httpsnoop"
 	"github.com/gorilla/mux"
+	"github.com/raphaelreyna/latte/internal/logging"
+	"github.com/raphaelreyna/latte/internal/metrics"
+	"github.com/raphaelreyna/latte/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func (s *Server) routes() *Server {
 	// Create and set up http router
 	s.router = mux.NewRouter()
-	s.router.HandleFunc("/generate", s.handleGenerate()).Methods("POST")
-	s.router.HandleFunc("/register", s.handleRegister()).Methods("POST")
+	s.router.HandleFunc("/generate", s.authorize(ScopeGenerate, s.rateLimit(true, s.handleGenerate()))).Methods("POST")
+	s.router.HandleFunc("/lint", s.authorize(ScopeGenerate, s.rateLimit(false, s.handleLint()))).Methods("POST")
+	s.router.HandleFunc("/register", s.authorize(ScopeRegister, s.rateLimit(false, s.handleRegister()))).Methods("POST")
 	s.router.HandleFunc("/ping", s.handlePing()).Methods("GET")
+	s.router.HandleFunc("/healthz", s.handleHealth(s.livenessChecks())).Methods("GET")
+	s.router.HandleFunc("/readyz", s.handleHealth(s.readinessChecks())).Methods("GET")
+	s.router.Handle("/metrics", metrics.Handler()).Methods("GET")
+	s.router.Use(s.requestID, s.instrument)
 	return s
 }
 
+// instrument records the count and latency of requests to each route, and traces each request.
+// Trace context sent by the client is propagated.
+func (s *Server) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if cr := mux.CurrentRoute(r); cr != nil {
+			if tmpl, err := cr.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Tracer().Start(ctx, r.Method+" "+route, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+		span.SetAttributes(semconv.HTTPServerAttributesFromHTTPRequest("latte", route, r)...)
+		span.SetAttributes(attribute.String("latte.request_id", RequestIDFromContext(ctx)))
+		if sc := span.SpanContext(); sc.IsValid() {
+			ctx = logging.NewContext(ctx, logging.FromContext(ctx).WithField("trace_id", sc.TraceID().String()))
+		}
+
+		m := httpsnoop.CaptureMetrics(next, w, r.WithContext(ctx))
+		metrics.Requests.WithLabelValues(route, strconv.Itoa(m.Code)).Inc()
+		metrics.RequestDuration.WithLabelValues(route).Observe(m.Duration.Seconds())
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(m.Code))
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(m.Code))
+	})
+}
+
 func (s *Server) handlePing() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("PONG"))
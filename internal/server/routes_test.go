@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/raphaelreyna/latte/internal/logging"
+)
+
+func TestServer_Metrics(t *testing.T) {
+	s := (&Server{log: logging.Discard()}).routes()
+
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/ping", nil))
+
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != 200 {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+
+	body := rr.Body.String()
+	for _, expected := range []string{
+		`latte_http_requests_total{code="200",route="/ping"}`,
+		`latte_http_request_duration_seconds_count{route="/ping"}`,
+		"latte_template_cache_hits_total",
+		"latte_jobs_active",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected metrics to contain %s", expected)
+		}
+	}
+}
+
+func TestServer_RequestID(t *testing.T) {
+	s := (&Server{log: logging.Discard()}).routes()
+
+	// Client provided IDs are echoed back, including in error bodies
+	req := httptest.NewRequest("POST", "/generate", strings.NewReader("{"))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(RequestIDHeader, "abc-123")
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, req)
+	if id := rr.Header().Get(RequestIDHeader); id != "abc-123" {
+		t.Errorf("expected request id to be echoed, got %q", id)
+	}
+	if !strings.Contains(rr.Body.String(), `"requestID":"abc-123"`) {
+		t.Errorf("expected error body to contain request id, got %s", rr.Body.String())
+	}
+
+	// Unusable IDs are replaced
+	req = httptest.NewRequest("GET", "/ping", nil)
+	req.Header.Set(RequestIDHeader, "bad id\n")
+	rr = httptest.NewRecorder()
+	s.ServeHTTP(rr, req)
+	if id := rr.Header().Get(RequestIDHeader); id == "" || id == "bad id\n" {
+		t.Errorf("expected a generated request id, got %q", id)
+	}
+}
@@ -5,22 +5,86 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"os"
+	"sync"
 
 	"github.com/gorilla/mux"
 	"github.com/raphaelreyna/latte/internal/job"
+	"github.com/sirupsen/logrus"
 )
 
 type Server struct {
-	router     *mux.Router
-	rootDir    string
-	db         DB
-	cmd        string
-	errLog     *log.Logger
-	infoLog    *log.Logger
+	router    *mux.Router
+	rootDir   string
+	db        DB
+	cmd       string
+	log       logrus.FieldLogger
 	tmplCache *job.TemplateCache
+	auth      Authenticator
+	limiter   *limiter
+	queue     *jobQueue
+
+	// jobs tracks running jobs until their work directories have been removed
+	jobs sync.WaitGroup
+
+	minFreeSpace uint64
+	reqLimits    job.RequestLimits
+}
+
+// Option configures optional behavior of a Server.
+type Option func(*Server) error
+
+// WithAuthenticator has the server require clients to be authenticated by a before generating PDFs or registering files.
+func WithAuthenticator(a Authenticator) Option {
+	return func(s *Server) error {
+		s.auth = a
+		return nil
+	}
+}
+
+// WithLimits has the server enforce per client rate limits and daily quotas.
+func WithLimits(l Limits) Option {
+	return func(s *Server) error {
+		if l.Rate < 0 || l.Burst < 0 || l.DailyCompiles < 0 || l.DailyStorage < 0 {
+			return fmt.Errorf("limits must not be negative: %+v", l)
+		}
+		if l != (Limits{}) {
+			s.limiter = newLimiter(l)
+		}
+		return nil
+	}
+}
+
+// WithJobQueue has the server compile at most maxActive jobs at once, with at most maxQueued more waiting their turn.
+// Jobs beyond that are turned away; a maxQueued of zero lets any number of jobs wait.
+func WithJobQueue(maxActive, maxQueued int) Option {
+	return func(s *Server) error {
+		if maxActive < 1 || maxQueued < 0 {
+			return fmt.Errorf("invalid job queue size: %d active, %d queued", maxActive, maxQueued)
+		}
+		s.queue = newJobQueue(maxActive, maxQueued)
+		return nil
+	}
+}
+
+// WithMinFreeSpace has the server report itself as not ready when fewer than n bytes are free in its root directory.
+func WithMinFreeSpace(n uint64) Option {
+	return func(s *Server) error {
+		s.minFreeSpace = n
+		return nil
+	}
+}
+
+// WithRequestLimits has the server turn away requests that exceed l with a 413 status.
+func WithRequestLimits(l job.RequestLimits) Option {
+	return func(s *Server) error {
+		if l.MaxBodySize < 0 || l.MaxResources < 0 || l.MaxResourceSize < 0 || l.MaxDetailsDepth < 0 {
+			return fmt.Errorf("request limits must not be negative: %+v", l)
+		}
+		s.reqLimits = l
+		return nil
+	}
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -42,7 +106,7 @@ func (s *Server) respond(w http.ResponseWriter, payload interface{}, code int) [
 	case io.ReadCloser:
 		_, err := io.Copy(w, payload.(io.ReadCloser))
 		if err != nil {
-			s.errLog.Println(err)
+			s.log.WithError(err).Error("error while writing response")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return nil
 		}
@@ -50,7 +114,7 @@ func (s *Server) respond(w http.ResponseWriter, payload interface{}, code int) [
 	default:
 		payload, err := json.Marshal(payload)
 		if err != nil {
-			s.errLog.Println(err)
+			s.log.WithError(err).Error("error while encoding response")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return nil
 		}
@@ -59,20 +123,32 @@ func (s *Server) respond(w http.ResponseWriter, payload interface{}, code int) [
 	}
 }
 
-func NewServer(root, cmd string, db DB, eLog, iLog *log.Logger, tCacheSize int) (*Server, error) {
+type errorResponse struct {
+	Error     string `json:"error"`
+	Data      string `json:"data,omitempty"`
+	RequestID string `json:"requestID,omitempty"`
+}
+
+// respondError sends msg to the client as a JSON error, tagged with the ID of request r.
+func (s *Server) respondError(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	s.respond(w, &errorResponse{Error: msg, RequestID: RequestIDFromContext(r.Context())}, code)
+}
+
+func NewServer(root, cmd string, db DB, logger logrus.FieldLogger, tCacheSize int, opts ...Option) (*Server, error) {
 	var err error
 	// Ping db to ensure connection
 	if db != nil {
 		if err = db.Ping(context.Background()); err != nil {
 			return nil, fmt.Errorf("error while pinging database: %v", err)
 		}
-		iLog.Println("successfully connected to database")
+		logger.Info("successfully connected to database")
+		db = instrumentedDB{db}
 	}
 	s := &Server{
-		rootDir:    root,
-		db:         db,
-		errLog:     eLog,
-		infoLog:    iLog,
+		rootDir: root,
+		db:      db,
+		log:     logger,
 	}
 
 	// Create the template cache
@@ -90,5 +166,31 @@ func NewServer(root, cmd string, db DB, eLog, iLog *log.Logger, tCacheSize int)
 		return nil, err
 	}
 	s.cmd = cmd
+
+	for _, opt := range opts {
+		if err = opt(s); err != nil {
+			return nil, err
+		}
+	}
 	return s.routes(), nil
 }
+
+// Close waits for running jobs to finish and for their work directories to be removed, then closes the database if
+// it can be closed. An error is returned if ctx is done before the jobs finish.
+func (s *Server) Close(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.jobs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("error while waiting for jobs to finish: %v", ctx.Err())
+	}
+
+	if c, ok := s.db.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type closableDB struct {
+	mockDB
+	closed bool
+}
+
+func (cdb *closableDB) Close() error {
+	cdb.closed = true
+	return nil
+}
+
+func TestServer_Close(t *testing.T) {
+	db := &closableDB{}
+	s := &Server{db: instrumentedDB{db}}
+
+	// A running job should keep the database open until it finishes
+	s.jobs.Add(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.Close(ctx); err == nil {
+		t.Fatal("expected an error while a job is still running")
+	}
+	if db.closed {
+		t.Fatal("database closed while a job is still running")
+	}
+
+	s.jobs.Done()
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !db.closed {
+		t.Fatal("expected database to be closed")
+	}
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ClientAuth controls whether clients must present a certificate when connecting over TLS.
+type ClientAuth string
+
+var (
+	// ClientAuthNone never asks clients for a certificate.
+	ClientAuthNone ClientAuth = ""
+	// ClientAuthRequest verifies a clients certificate if it presents one, letting it authenticate by other means otherwise.
+	ClientAuthRequest ClientAuth = "request"
+	// ClientAuthRequire refuses connections from clients that don't present a valid certificate.
+	ClientAuthRequire ClientAuth = "require"
+)
+
+func (ca ClientAuth) IsValid() bool {
+	return ca == ClientAuthNone || ca == ClientAuthRequest || ca == ClientAuthRequire
+}
+
+// TLSFiles serves the certificate, key and client CA bundle found in a set of files,
+// picking up any changes made to them without needing to restart the server.
+type TLSFiles struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	ClientAuth   ClientAuth
+
+	mu    sync.RWMutex
+	cert  *tls.Certificate
+	pool  *x509.CertPool
+	stamp string
+}
+
+// Check returns an error if the client auth mode is invalid or can't be enforced.
+func (tf *TLSFiles) Check() error {
+	if !tf.ClientAuth.IsValid() {
+		return fmt.Errorf("invalid TLS client auth mode: %s", tf.ClientAuth)
+	}
+	if tf.ClientAuth != ClientAuthNone && tf.ClientCAFile == "" {
+		return fmt.Errorf("TLS client auth mode %q needs a client CA file to verify client certificates with", tf.ClientAuth)
+	}
+	return nil
+}
+
+// Load reads the certificate, key and client CA bundle if they have changed since they were last read.
+// If reading fails, the previously loaded files continue to be used.
+func (tf *TLSFiles) Load() (changed bool, err error) {
+	// Any change to a files modification time or size, even going backwards, counts as a change
+	var stamp []string
+	for _, path := range []string{tf.CertFile, tf.KeyFile, tf.ClientCAFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return false, err
+		}
+		stamp = append(stamp, fmt.Sprintf("%d:%d", info.ModTime().UnixNano(), info.Size()))
+	}
+	latest := strings.Join(stamp, ",")
+
+	tf.mu.RLock()
+	loaded := tf.cert != nil && latest == tf.stamp
+	tf.mu.RUnlock()
+	if loaded {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(tf.CertFile, tf.KeyFile)
+	if err != nil {
+		return false, err
+	}
+	var pool *x509.CertPool
+	if tf.ClientCAFile != "" {
+		data, err := ioutil.ReadFile(tf.ClientCAFile)
+		if err != nil {
+			return false, err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return false, fmt.Errorf("no certificates found in %s", tf.ClientCAFile)
+		}
+	}
+
+	tf.mu.Lock()
+	tf.cert, tf.pool, tf.stamp = &cert, pool, latest
+	tf.mu.Unlock()
+	return true, nil
+}
+
+// Watch checks the files for changes every interval until ctx is done.
+// If interval isn't positive the files are never checked and Watch returns immediately.
+func (tf *TLSFiles) Watch(ctx context.Context, interval time.Duration, log logrus.FieldLogger) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		changed, err := tf.Load()
+		if err != nil {
+			log.WithError(err).Error("error while reloading TLS files; continuing with previously loaded files")
+			continue
+		}
+		if changed {
+			log.WithField("cert_file", tf.CertFile).Info("reloaded TLS files")
+		}
+	}
+}
+
+// Config returns a TLS config that always uses the most recently loaded files.
+// Load must have succeeded at least once before the config is used.
+func (tf *TLSFiles) Config() *tls.Config {
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// The config returned for each client replaces this one entirely so it has to offer HTTP/2 itself
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		tf.mu.RLock()
+		defer tf.mu.RUnlock()
+		c := base.Clone()
+		c.GetConfigForClient = nil
+		c.Certificates = []tls.Certificate{*tf.cert}
+		c.ClientCAs = tf.pool
+		switch {
+		case tf.pool == nil:
+			c.ClientAuth = tls.NoClientCert
+		case tf.ClientAuth == ClientAuthRequire:
+			c.ClientAuth = tls.RequireAndVerifyClientCert
+		default:
+			c.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+		return c, nil
+	}
+	return base
+}
+
+// ClientCerts authenticates clients by the verified certificate they presented while connecting over TLS.
+// Certificates are matched by their subject common name or any of their DNS or email subject alternative names.
+type ClientCerts map[string]*Identity
+
+// Add grants the given scopes to clients whose certificate carries the given name.
+func (cc ClientCerts) Add(name string, scopes ...Scope) {
+	cc[name] = &Identity{Name: name, Scopes: scopes}
+}
+
+func (cc ClientCerts) Authenticate(r *http.Request) (*Identity, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil, ErrNoCredentials
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, name := range names {
+		if id, exists := cc[name]; exists && name != "" {
+			return id, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown client certificate: %s", cert.Subject)
+}
+
+// ParseClientCerts reads client certificate identities from r, one per line, in the form:
+//
+//	NAME SCOPE[,SCOPE...]
+//
+// Blank lines and lines starting with '#' are ignored.
+func ParseClientCerts(r io.Reader) (ClientCerts, error) {
+	cc := ClientCerts{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected NAME SCOPES", n)
+		}
+		var scopes []Scope
+		for _, s := range strings.Split(fields[1], ",") {
+			sc := Scope(s)
+			if !sc.IsValid() {
+				return nil, fmt.Errorf("line %d: invalid scope: %s", n, s)
+			}
+			scopes = append(scopes, sc)
+		}
+		cc.Add(fields[0], scopes...)
+	}
+	return cc, scanner.Err()
+}
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raphaelreyna/latte/internal/logging"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert creates a certificate for name signed by parent, or a self-signed CA if parent is nil.
+func newTestCert(t *testing.T, name string, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		DNSNames:     []string{name},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func (tc *testCert) tlsCert() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{tc.cert.Raw}, PrivateKey: tc.key}
+}
+
+func TestTLSFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "latte-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, "Test CA", nil, 0)
+	tf := &TLSFiles{
+		CertFile:     filepath.Join(dir, "cert.pem"),
+		KeyFile:      filepath.Join(dir, "key.pem"),
+		ClientCAFile: filepath.Join(dir, "ca.pem"),
+		ClientAuth:   ClientAuthRequest,
+	}
+	writeServerCert := func(name string, modTime time.Time) {
+		c := newTestCert(t, name, ca, x509.ExtKeyUsageServerAuth)
+		for path, data := range map[string][]byte{tf.CertFile: c.certPEM, tf.KeyFile: c.keyPEM, tf.ClientCAFile: ca.certPEM} {
+			if err := ioutil.WriteFile(path, data, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(path, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	writeServerCert("first.example.com", time.Now().Add(-time.Minute))
+	if changed, err := tf.Load(); err != nil || !changed {
+		t.Fatalf("expected initial load to succeed, got changed=%v err=%v", changed, err)
+	}
+
+	client := newTestCert(t, "client.example.com", ca, x509.ExtKeyUsageClientAuth)
+	stranger := newTestCert(t, "stranger.example.com", ca, x509.ExtKeyUsageClientAuth)
+	auth := ClientCerts{}
+	auth.Add("client.example.com", ScopeGenerate)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := auth.Authenticate(r)
+		switch {
+		case err == ErrNoCredentials:
+			w.WriteHeader(http.StatusUnauthorized)
+		case err != nil:
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.Write([]byte(id.Name))
+		}
+	}))
+	ts.TLS = tf.Config()
+	ts.EnableHTTP2 = true
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(serverName string, cert *testCert) (*http.Response, error) {
+		cfg := &tls.Config{RootCAs: roots, ServerName: serverName}
+		if cert != nil {
+			cfg.Certificates = []tls.Certificate{cert.tlsCert()}
+		}
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg, ForceAttemptHTTP2: true}}
+		return c.Get(ts.URL)
+	}
+
+	tt := []struct {
+		Name         string
+		ServerName   string
+		ClientCert   *testCert
+		ExpectedCode int
+	}{
+		{Name: "No client certificate", ServerName: "first.example.com", ExpectedCode: http.StatusUnauthorized},
+		{Name: "Known client certificate", ServerName: "first.example.com", ClientCert: client, ExpectedCode: http.StatusOK},
+		{Name: "Unknown client certificate", ServerName: "first.example.com", ClientCert: stranger, ExpectedCode: http.StatusForbidden},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			resp, err := get(tc.ServerName, tc.ClientCert)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.ExpectedCode {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedCode, resp.StatusCode)
+			}
+		})
+	}
+
+	t.Run("HTTP/2", func(t *testing.T) {
+		resp, err := get("first.example.com", client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.ProtoMajor != 2 {
+			t.Fatalf("expected HTTP/2 to be negotiated, got %s", resp.Proto)
+		}
+	})
+
+	t.Run("Unchanged files", func(t *testing.T) {
+		if changed, err := tf.Load(); err != nil || changed {
+			t.Fatalf("expected nothing to be reloaded, got changed=%v err=%v", changed, err)
+		}
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		writeServerCert("second.example.com", time.Now())
+		if changed, err := tf.Load(); err != nil || !changed {
+			t.Fatalf("expected reload to succeed, got changed=%v err=%v", changed, err)
+		}
+		if _, err := get("first.example.com", nil); err == nil || !strings.Contains(err.Error(), "first.example.com") {
+			t.Fatalf("expected the old certificate to no longer be served, got %v", err)
+		}
+		resp, err := get("second.example.com", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	})
+
+	t.Run("Bad reload keeps serving", func(t *testing.T) {
+		if err := ioutil.WriteFile(tf.KeyFile, []byte("garbage"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tf.Load(); err == nil {
+			t.Fatal("expected an error while loading a bad key")
+		}
+		resp, err := get("second.example.com", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	})
+}
+
+func TestParseClientCerts(t *testing.T) {
+	cc, err := ParseClientCerts(strings.NewReader(`
+# billing service
+billing.internal generate
+ops@example.com admin
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := cc["billing.internal"]; !id.HasScope(ScopeGenerate) || id.HasScope(ScopeRegister) {
+		t.Errorf("unexpected identity for billing.internal: %+v", id)
+	}
+	if id := cc["ops@example.com"]; !id.HasScope(ScopeRegister) {
+		t.Errorf("unexpected identity for ops@example.com: %+v", id)
+	}
+
+	for _, bad := range []string{"billing.internal", "billing.internal generate,print"} {
+		if _, err := ParseClientCerts(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected an error parsing %q", bad)
+		}
+	}
+}
+
+func TestTLSFiles_Check(t *testing.T) {
+	tt := []struct {
+		Name     string
+		Files    *TLSFiles
+		Expected string
+	}{
+		{Name: "No client auth", Files: &TLSFiles{}},
+		{Name: "Required with CA", Files: &TLSFiles{ClientAuth: ClientAuthRequire, ClientCAFile: "ca.pem"}},
+		{Name: "Required without CA", Files: &TLSFiles{ClientAuth: ClientAuthRequire}, Expected: "needs a client CA file"},
+		{Name: "Requested without CA", Files: &TLSFiles{ClientAuth: ClientAuthRequest}, Expected: "needs a client CA file"},
+		{Name: "Invalid mode", Files: &TLSFiles{ClientAuth: "demand", ClientCAFile: "ca.pem"}, Expected: "invalid TLS client auth mode"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := tc.Files.Check()
+			if tc.Expected == "" && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if tc.Expected != "" && (err == nil || !strings.Contains(err.Error(), tc.Expected)) {
+				t.Fatalf("expected an error containing %q, got %v", tc.Expected, err)
+			}
+		})
+	}
+}
+
+func TestTLSFiles_Watch_NoInterval(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		(&TLSFiles{}).Watch(context.Background(), 0, logging.Discard())
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected Watch to return immediately without an interval")
+	}
+}